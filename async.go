@@ -0,0 +1,129 @@
+package statsd
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// queuedMetric is a metric waiting to be recorded, in the queue of an asynchronous
+// client, see WithAsync, or in a Batch.
+type queuedMetric struct {
+	c      *Client
+	force  bool
+	typ    MetricType
+	stat   string
+	rate   float64
+	tags   []string
+	format string
+	args   []interface{}
+	// ack is closed by the worker instead of recording anything, see asyncQueue.drain.
+	ack chan struct{}
+}
+
+// asyncQueue hands the metrics over to a single worker recording them,
+// so that callers never wait for the client lock.
+type asyncQueue struct {
+	// m is held for reading while enqueuing and for writing while stopping,
+	// so that nothing is enqueued once the queue is closed.
+	m       sync.RWMutex
+	stopped bool
+	queue   chan queuedMetric
+	done    chan struct{}
+	dropped uint64
+}
+
+func newAsyncQueue(size int) *asyncQueue {
+	q := &asyncQueue{
+		queue: make(chan queuedMetric, size),
+		done:  make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// enqueue queues a metric without blocking, it is dropped if the queue is full.
+func (q *asyncQueue) enqueue(m queuedMetric) error {
+	q.m.RLock()
+	defer q.m.RUnlock()
+	if q.stopped {
+		return ErrClosed
+	}
+	select {
+	case q.queue <- m:
+	default:
+		atomic.AddUint64(&q.dropped, 1)
+	}
+	return nil
+}
+
+// run records the queued metrics until the queue is stopped and drained.
+func (q *asyncQueue) run() {
+	defer close(q.done)
+	for m := range q.queue {
+		if m.ack != nil {
+			// Drain acknowledgements carry no client, there is no lock to take.
+			close(m.ack)
+			continue
+		}
+		m.c.m.Lock()
+		q.record(m)
+		// Record the metrics queued in the meantime without releasing the lock.
+		for n := len(q.queue); n > 0; n-- {
+			q.record(<-q.queue)
+		}
+		m.c.m.Unlock()
+	}
+}
+
+// record records a queued metric, the client lock must be held.
+func (q *asyncQueue) record(m queuedMetric) {
+	if m.ack != nil {
+		close(m.ack)
+		return
+	}
+	if err := m.c.emitLocked(m.force, m.typ, m.stat, m.rate, m.tags, m.format, m.args...); err != nil {
+		debug("dropping metric %s: %s", m.stat, err)
+	}
+}
+
+// drain waits for the worker to record the metrics queued so far, or for ctx to be done.
+// Unlike enqueue it waits for room in the queue instead of dropping.
+func (q *asyncQueue) drain(ctx context.Context) error {
+	ack := make(chan struct{})
+	q.m.RLock()
+	if q.stopped {
+		// stop already waited for the queue to be drained.
+		q.m.RUnlock()
+		return nil
+	}
+	select {
+	case q.queue <- queuedMetric{ack: ack}:
+	case <-ctx.Done():
+		q.m.RUnlock()
+		return ctx.Err()
+	}
+	q.m.RUnlock()
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stop closes the queue, metrics can't be enqueued anymore once it returns.
+// The worker keeps recording the metrics left in the queue, see wait.
+func (q *asyncQueue) stop() {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if !q.stopped {
+		q.stopped = true
+		close(q.queue)
+	}
+}
+
+// wait waits for the worker to record the metrics left in a stopped queue.
+func (q *asyncQueue) wait() {
+	<-q.done
+}
@@ -0,0 +1,92 @@
+package statsd
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAsync(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w, WithAsync(1000), WithPrefix("app."))
+	api := c.WithPrefix("api.")
+
+	var wg sync.WaitGroup
+	for _, client := range []*Client{c, api} {
+		wg.Add(1)
+		go func(client *Client) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if err := client.Incr("incr"); err != nil {
+					t.Error(err)
+				}
+			}
+		}(client)
+	}
+	wg.Wait()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Incr("incr"); err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+
+	counts := make(map[string]int)
+	for _, packet := range w.Packets() {
+		for _, line := range strings.Split(packet, "\n") {
+			counts[line]++
+		}
+	}
+	for line, want := range map[string]int{"app.incr:1|c": 100, "api.incr:1|c": 100} {
+		if counts[line] != want {
+			t.Errorf("want %d %q, got %d", want, line, counts[line])
+		}
+	}
+	if dropped := c.Stats().Dropped; dropped != 0 {
+		t.Errorf("expected no dropped metrics, got %d", dropped)
+	}
+}
+
+func TestAsyncQueueFull(t *testing.T) {
+	// The worker isn't started, the queue fills up.
+	q := &asyncQueue{queue: make(chan queuedMetric, 2)}
+	for i := 0; i < 3; i++ {
+		if err := q.enqueue(queuedMetric{stat: "incr"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q.dropped != 1 {
+		t.Errorf("want 1 dropped metric, got %d", q.dropped)
+	}
+}
+
+func TestAsyncFlush(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w, WithAsync(1000))
+	defer c.Close()
+	for i := 0; i < 100; i++ {
+		c.Incr("incr")
+		if err := c.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if packets := w.Packets(); len(packets) != i+1 {
+			t.Fatalf("want %d packets, got %d", i+1, len(packets))
+		}
+	}
+}
+
+func TestAsyncFlushIdle(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w, WithAsync(10))
+	defer c.Close()
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	c.Incr("incr")
+	time.Sleep(10 * time.Millisecond)
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, strings.Join(w.Packets(), ""), "incr:1|c")
+}
@@ -0,0 +1,278 @@
+package statsd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Batch groups metrics sent to the server together, in the same packet.
+// It is not safe for concurrent use.
+type Batch struct {
+	c       *Client
+	metrics []queuedMetric
+	// err is the first error found while adding the metrics, returned by Send.
+	err error
+}
+
+// Batch returns an empty batch of metrics for the client.
+func (c *Client) Batch() *Batch {
+	return &Batch{c: c}
+}
+
+func (b *Batch) add(typ MetricType, stat string, rate float64, tags []string, format string, args ...interface{}) {
+	b.metrics = append(b.metrics, queuedMetric{
+		c:      b.c,
+		typ:    typ,
+		stat:   stat,
+		rate:   rate,
+		tags:   tags,
+		format: format,
+		args:   args,
+	})
+}
+
+// Increment adds count to the counter of the given bucket, see Client.Increment.
+func (b *Batch) Increment(stat string, count int, rate float64) {
+	b.IncrementTags(stat, count, rate, nil)
+}
+
+// IncrementTags acts like Increment but tags the metric.
+func (b *Batch) IncrementTags(stat string, count int, rate float64, tags map[string]string) {
+	b.add(TypeCounter, stat, rate, tagList(tags), "%d", count)
+}
+
+// Incr increments the counter of the given bucket by one, see Client.Incr.
+func (b *Batch) Incr(stat string) {
+	b.Increment(stat, 1, 1)
+}
+
+// Decrement subtracts count from the counter of the given bucket, see Client.Decrement.
+func (b *Batch) Decrement(stat string, count int, rate float64) {
+	b.Increment(stat, -count, rate)
+}
+
+// Decr decrements the counter of the given bucket by one, see Client.Decr.
+func (b *Batch) Decr(stat string) {
+	b.Increment(stat, -1, 1)
+}
+
+// Duration records time spent for the given bucket, see Client.Duration.
+func (b *Batch) Duration(stat string, duration time.Duration, rate float64) {
+	b.DurationTags(stat, duration, rate, nil)
+}
+
+// DurationTags acts like Duration but tags the metric.
+func (b *Batch) DurationTags(stat string, duration time.Duration, rate float64, tags map[string]string) {
+	b.add(TypeTimer, stat, rate, tagList(tags), "%v", milliseconds(duration))
+}
+
+// Timing records time spent for the given bucket in milliseconds, see Client.Timing.
+func (b *Batch) Timing(stat string, delta int, rate float64) {
+	b.TimingTags(stat, delta, rate, nil)
+}
+
+// TimingTags acts like Timing but tags the metric.
+func (b *Batch) TimingTags(stat string, delta int, rate float64, tags map[string]string) {
+	b.add(TypeTimer, stat, rate, tagList(tags), "%d", delta)
+}
+
+// TimingFloat acts like Timing but takes a fractional number of milliseconds, see Client.TimingFloat.
+func (b *Batch) TimingFloat(stat string, delta float64, rate float64) {
+	b.TimingFloatTags(stat, delta, rate, nil)
+}
+
+// TimingFloatTags acts like TimingFloat but tags the metric.
+func (b *Batch) TimingFloatTags(stat string, delta float64, rate float64, tags map[string]string) {
+	b.add(TypeTimer, stat, rate, tagList(tags), "%s", decimal(delta))
+}
+
+// Histogram records a value in the histogram of the given bucket, see Client.Histogram.
+func (b *Batch) Histogram(stat string, value int, rate float64) {
+	b.HistogramTags(stat, value, rate, nil)
+}
+
+// HistogramTags acts like Histogram but tags the metric.
+func (b *Batch) HistogramTags(stat string, value int, rate float64, tags map[string]string) {
+	b.add(TypeHistogram, stat, rate, tagList(tags), "%d", value)
+}
+
+// HistogramFloat acts like Histogram but takes a float value, see Client.HistogramFloat.
+func (b *Batch) HistogramFloat(stat string, value float64, rate float64) {
+	b.HistogramFloatTags(stat, value, rate, nil)
+}
+
+// HistogramFloatTags acts like HistogramFloat but tags the metric.
+func (b *Batch) HistogramFloatTags(stat string, value float64, rate float64, tags map[string]string) {
+	b.add(TypeHistogram, stat, rate, tagList(tags), "%s", decimal(value))
+}
+
+// Gauge records arbitrary values for the given bucket, see Client.Gauge.
+func (b *Batch) Gauge(stat string, value int, rate float64) {
+	b.GaugeTags(stat, value, rate, nil)
+}
+
+// GaugeTags acts like Gauge but tags the metric.
+func (b *Batch) GaugeTags(stat string, value int, rate float64, tags map[string]string) {
+	if value < 0 {
+		b.add(TypeGauge, stat, rate, tagList(tags), "%d", negativeGauge{value})
+		return
+	}
+	b.add(TypeGauge, stat, rate, tagList(tags), "%d", value)
+}
+
+// GaugeFloat acts like Gauge but takes a float value, see Client.GaugeFloat.
+func (b *Batch) GaugeFloat(stat string, value float64, rate float64) {
+	b.GaugeFloatTags(stat, value, rate, nil)
+}
+
+// GaugeFloatTags acts like GaugeFloat but tags the metric.
+func (b *Batch) GaugeFloatTags(stat string, value float64, rate float64, tags map[string]string) {
+	if value < 0 {
+		b.add(TypeGauge, stat, rate, tagList(tags), "%s", negativeGauge{decimal(value)})
+		return
+	}
+	b.add(TypeGauge, stat, rate, tagList(tags), "%s", decimal(value))
+}
+
+// IncrementGauge increments the value of the gauge, see Client.IncrementGauge.
+func (b *Batch) IncrementGauge(stat string, value int, rate float64) {
+	b.IncrementGaugeTags(stat, value, rate, nil)
+}
+
+// IncrementGaugeTags acts like IncrementGauge but tags the metric.
+func (b *Batch) IncrementGaugeTags(stat string, value int, rate float64, tags map[string]string) {
+	if value < 0 {
+		b.add(TypeGauge, stat, rate, tagList(tags), "-%d", uint64(-value))
+		return
+	}
+	b.add(TypeGauge, stat, rate, tagList(tags), "+%d", uint64(value))
+}
+
+// DecrementGauge decrements the value of the gauge, see Client.DecrementGauge.
+func (b *Batch) DecrementGauge(stat string, value int, rate float64) {
+	b.DecrementGaugeTags(stat, value, rate, nil)
+}
+
+// DecrementGaugeTags acts like DecrementGauge but tags the metric.
+func (b *Batch) DecrementGaugeTags(stat string, value int, rate float64, tags map[string]string) {
+	if value < 0 {
+		b.add(TypeGauge, stat, rate, tagList(tags), "+%d", uint64(-value))
+		return
+	}
+	b.add(TypeGauge, stat, rate, tagList(tags), "-%d", uint64(value))
+}
+
+// Distribution records a value in a distribution, see Client.Distribution.
+func (b *Batch) Distribution(stat string, value float64, rate float64) {
+	b.DistributionTags(stat, value, rate, nil)
+}
+
+// DistributionTags acts like Distribution but tags the metric.
+func (b *Batch) DistributionTags(stat string, value float64, rate float64, tags map[string]string) {
+	b.add(TypeDistribution, stat, rate, tagList(tags), "%s", decimal(value))
+}
+
+// Unique records unique occurences of events, see Client.Unique.
+func (b *Batch) Unique(stat string, value int, rate float64) {
+	b.UniqueTags(stat, value, rate, nil)
+}
+
+// UniqueTags acts like Unique but tags the metric.
+func (b *Batch) UniqueTags(stat string, value int, rate float64, tags map[string]string) {
+	b.add(TypeSet, stat, rate, tagList(tags), "%d", value)
+}
+
+// UniqueString acts like Unique for string values, see Client.UniqueString.
+// A value containing a newline makes Send fail.
+func (b *Batch) UniqueString(stat string, value string, rate float64) {
+	b.UniqueStringTags(stat, value, rate, nil)
+}
+
+// UniqueStringTags acts like UniqueString but tags the metric.
+func (b *Batch) UniqueStringTags(stat string, value string, rate float64, tags map[string]string) {
+	if strings.ContainsAny(value, "\r\n") {
+		if b.err == nil {
+			b.err = fmt.Errorf("statsd: set value %q contains a newline", value)
+		}
+		return
+	}
+	b.add(TypeSet, stat, rate, tagList(tags), "%s", value)
+}
+
+// batchLines collects the lines of a Batch being sent, along with the side effects
+// of recording them, which only apply once the lines are buffered.
+type batchLines struct {
+	lines   []string
+	sampled uint64
+	effects []func()
+}
+
+// apply applies the side effects deferred while the batch was recorded, the lock must be held.
+func (b *batchLines) apply(c *Client) {
+	c.sampled += b.sampled
+	for _, f := range b.effects {
+		f()
+	}
+}
+
+// effect applies a side effect of recording a metric, such as updating the
+// Prometheus metrics, or defers it until the Batch being sent is buffered.
+// The lock must be held.
+func (c *Client) effect(f func()) {
+	if c.batch != nil {
+		c.batch.effects = append(c.batch.effects, f)
+		return
+	}
+	f()
+}
+
+// Send samples the metrics of the batch and buffers them at once, under a single
+// acquisition of the client lock. The buffer is flushed beforehand if they would
+// not fit in the current packet, so they are sent in the same packet. Nothing is
+// sent if one of them is invalid, or if they don't fit in a packet at all, and
+// the client is left as if the batch was never sent: no sequence number is
+// consumed and neither Stats nor the Prometheus metrics account for it.
+// The batch is empty once sent.
+func (b *Batch) Send() error {
+	metrics, err := b.metrics, b.err
+	b.metrics, b.err = nil, nil
+	c := b.c
+	if c.nop {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+
+	seq := c.seq
+	batch := new(batchLines)
+	c.batch = batch
+	for _, m := range metrics {
+		if err := m.c.emitLocked(m.force, m.typ, m.stat, m.rate, m.tags, m.format, m.args...); err != nil {
+			c.batch = nil
+			c.seq = seq
+			return err
+		}
+	}
+	c.batch = nil
+	if len(batch.lines) > 0 {
+		var buffered bool
+		buffered, err = c.write(strings.Join(batch.lines, "\n"))
+		if !buffered {
+			// Nothing is sent, the batch leaves no trace either.
+			c.seq = seq
+			return err
+		}
+	}
+	batch.apply(c)
+	return err
+}
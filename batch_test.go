@@ -0,0 +1,103 @@
+package statsd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w, WithPrefix("api."))
+	c.Unique(strings.Repeat("a", 450), 1, 1)
+
+	b := c.Batch()
+	b.Incr("requests")
+	b.Gauge("workers", -2, 1)
+	b.Duration("latency", 350*time.Millisecond, 1)
+	b.Distribution("bytes", 1.5, 1)
+	if err := b.Send(); err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+
+	packets := w.Packets()
+	if len(packets) != 2 {
+		t.Fatalf("expected the batch in its own packet, got %d packets", len(packets))
+	}
+	assert(t, packets[1], "api.requests:1|c\napi.workers:0|g\napi.workers:-2|g\napi.latency:350|ms\napi.bytes:1.5|d")
+}
+
+func TestBatchInvalid(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w, WithStrictNames())
+	b := c.Batch()
+	b.Incr("requests")
+	b.Incr("")
+	if err := b.Send(); err == nil {
+		t.Error("expected an error for an invalid metric")
+	}
+	b.Incr("requests")
+	if err := b.Send(); err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, strings.Join(w.Packets(), ""), "requests:1|c")
+}
+
+func TestBatchMethods(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w)
+	tags := map[string]string{"env": "prod"}
+
+	b := c.Batch()
+	b.DurationTags("duration", time.Millisecond, 1, tags)
+	b.TimingFloat("timing", 1.5, 1)
+	b.Histogram("histogram", 2, 1)
+	b.HistogramFloat("histogram", 2.5, 1)
+	b.GaugeFloatTags("gauge", 1.5, 1, tags)
+	b.IncrementGauge("gauge", 2, 1)
+	b.DecrementGauge("gauge", 3, 1)
+	b.DistributionTags("distribution", 1.5, 1, tags)
+	b.UniqueTags("unique", 1, 1, tags)
+	b.UniqueString("unique", "user", 1)
+	if err := b.Send(); err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, strings.Join(w.Packets(), ""), strings.Join([]string{
+		"duration:1|ms|#env:prod",
+		"timing:1.5|ms",
+		"histogram:2|h",
+		"histogram:2.5|h",
+		"gauge:1.5|g|#env:prod",
+		"gauge:+2|g",
+		"gauge:-3|g",
+		"distribution:1.5|d|#env:prod",
+		"unique:1|s|#env:prod",
+		"unique:user|s",
+	}, "\n"))
+
+	b.UniqueString("unique", "a\nb", 1)
+	if err := b.Send(); err == nil {
+		t.Error("expected an error for a value containing a newline")
+	}
+}
+
+func TestBatchRejectedSideEffects(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w, WithSequenceTracking())
+	b := c.Batch()
+	b.Increment("sampled", 1, 0)
+	b.Incr("requests")
+	b.Incr(strings.Repeat("a", defaultBufSize))
+	if err := b.Send(); err == nil {
+		t.Fatal("expected an error for an oversized batch")
+	}
+	if sampled := c.Stats().Sampled; sampled != 0 {
+		t.Errorf("expected no sampled metric, got %d", sampled)
+	}
+	c.Incr("requests")
+	c.Flush()
+	assert(t, strings.Join(w.Packets(), ""), "requests:1|c|#seq:1")
+}
@@ -0,0 +1,78 @@
+package statsd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// collector buffers the current value of a metric aggregated client side, the client lock must be held.
+type collector struct {
+	stat    string
+	collect func() error
+}
+
+// FlushMetric immediately sends the value aggregated client side for the given bucket,
+// such as a LocalCounter or a BucketedHistogram, and resets it. Other aggregated
+// metrics are left for the next flush. The value is sent in its own packet,
+// the metrics already buffered stay in the buffer. It returns an error if no
+// metric is aggregated under that name.
+func (c *Client) FlushMetric(stat string) error {
+	if c.nop {
+		return nil
+	}
+	c.sampleGauges(stat)
+	defer c.m.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	found := false
+	// The lines are captured as for a Batch, so that they don't go through the buffer.
+	batch := new(batchLines)
+	c.batch = batch
+	for _, col := range c.collectors {
+		if col.stat != stat {
+			continue
+		}
+		found = true
+		if err := col.collect(); err != nil {
+			c.batch = nil
+			return err
+		}
+	}
+	c.batch = nil
+	if !found {
+		return fmt.Errorf("statsd: no aggregated metric %q", stat)
+	}
+	batch.apply(c)
+	return c.writePackets(batch.lines)
+}
+
+// writePackets sends lines right away in as few packets as possible, bypassing
+// the buffer. The buffer always ends with a complete line, so the packets never
+// split a buffered one on streams. The lock must be held.
+func (c *Client) writePackets(lines []string) error {
+	var packets []string
+	for _, line := range lines {
+		if !c.stream && len(line) > c.size {
+			return fmt.Errorf("statsd: metric of %d bytes exceeds the packet size %d: %.32q...", len(line), c.size, line)
+		}
+		if c.stream {
+			line += "\n"
+		} else if n := len(packets); n > 0 && len(packets[n-1])+1+len(line) <= c.size {
+			packets[n-1] += "\n" + line
+			continue
+		}
+		packets = append(packets, line)
+	}
+	if c.stream {
+		packets = []string{strings.Join(packets, "")}
+	}
+	for _, packet := range packets {
+		if _, err := (sink{c.core}).Write([]byte(packet)); err != nil {
+			c.flushErrors++
+			c.reconnect()
+			return err
+		}
+	}
+	return nil
+}
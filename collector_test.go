@@ -0,0 +1,44 @@
+package statsd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFlushMetric(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	alerts := c.LocalCounter("alerts")
+	requests := c.LocalCounter("requests")
+	alerts.Add(2)
+	requests.Add(10)
+	err := c.FlushMetric("alerts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, buf.String(), "alerts:2|c")
+	buf.Reset()
+	c.Flush()
+	assert(t, buf.String(), "requests:10|c")
+	if err := c.FlushMetric("unknown"); err == nil {
+		t.Error("expected an error for an unknown metric")
+	}
+}
+
+func TestFlushMetricBuffered(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w)
+	crit := c.LocalCounter("crit")
+	c.Incr("other")
+	crit.Add(3)
+	if err := c.FlushMetric("crit"); err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	packets := w.Packets()
+	if len(packets) != 2 {
+		t.Fatalf("incorrect number of packets, want 2, got %d", len(packets))
+	}
+	assert(t, packets[0], "crit:3|c")
+	assert(t, packets[1], "other:1|c")
+}
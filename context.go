@@ -0,0 +1,118 @@
+package statsd
+
+import (
+	"context"
+	"time"
+)
+
+type forceKey struct{}
+
+// ForceEmit returns a copy of ctx flagging its metrics to bypass sampling:
+// the context aware methods, such as IncrementCtx, always send them at full rate.
+// It is meant to debug specific requests without disabling sampling globally.
+func ForceEmit(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceKey{}, true)
+}
+
+func forced(ctx context.Context) bool {
+	force, _ := ctx.Value(forceKey{}).(bool)
+	return force
+}
+
+// contextTags runs the tag extractor on ctx, outside of the lock as it is user code.
+// The extractor is loaded atomically, so that asynchronous clients never wait for the lock.
+func (c *Client) contextTags(ctx context.Context) []string {
+	extract, _ := c.extractor.Load().(func(context.Context) []string)
+	if extract == nil {
+		return nil
+	}
+	return extract(ctx)
+}
+
+// FlushContext acts like Flush but gives up once ctx is done, returning ctx.Err().
+// The deadline of ctx bounds the writes to the connection, so that a blocked
+// stream doesn't hold the caller past it. The packet being written is then lost.
+func (c *Client) FlushContext(ctx context.Context) error {
+	_, err := c.flushAll(ctx, false)
+	return err
+}
+
+// watchContext interrupts the writes to the connection once ctx is done and
+// returns a function restoring the connection, the lock must be held.
+func (c *Client) watchContext(ctx context.Context) (release func()) {
+	conn := c.deadliner()
+	if conn == nil || ctx.Done() == nil {
+		return func() {}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.ctxDeadline = deadline
+		conn.SetWriteDeadline(deadline)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			// A deadline in the past makes pending and future writes fail immediately.
+			conn.SetWriteDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		c.ctxDeadline = time.Time{}
+		conn.SetWriteDeadline(time.Time{})
+	}
+}
+
+// contextError returns the error of ctx if a write failed because ctx is done.
+// The write deadline can expire slightly before the context does,
+// in which case the context deadline exceeded is reported as well.
+func contextError(ctx context.Context, err error) error {
+	if cerr := ctx.Err(); cerr != nil {
+		return cerr
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+func (c *Client) sendContext(ctx context.Context, typ MetricType, stat string, rate float64, format string, args ...interface{}) error {
+	return c.emit(forced(ctx), typ, stat, rate, c.contextTags(ctx), format, args...)
+}
+
+// IncrementCtx acts like Increment but tags the metric with the tags extracted from ctx,
+// see WithContextTagExtractor, and honors ForceEmit.
+func (c *Client) IncrementCtx(ctx context.Context, stat string, count int, rate float64) error {
+	return c.sendContext(ctx, TypeCounter, stat, rate, "%d", count)
+}
+
+// IncrCtx acts like Incr but tags the metric with the tags extracted from ctx,
+// see WithContextTagExtractor.
+func (c *Client) IncrCtx(ctx context.Context, stat string) error {
+	return c.IncrementCtx(ctx, stat, 1, 1)
+}
+
+// DurationCtx acts like Duration but tags the metric with the tags extracted from ctx,
+// see WithContextTagExtractor, and honors ForceEmit.
+func (c *Client) DurationCtx(ctx context.Context, stat string, duration time.Duration, rate float64) error {
+	return c.sendContext(ctx, TypeTimer, stat, rate, "%v", milliseconds(duration))
+}
+
+// TimingCtx acts like Timing but tags the metric with the tags extracted from ctx,
+// see WithContextTagExtractor, and honors ForceEmit.
+func (c *Client) TimingCtx(ctx context.Context, stat string, delta int, rate float64) error {
+	return c.sendContext(ctx, TypeTimer, stat, rate, "%d", delta)
+}
+
+// GaugeCtx acts like Gauge but tags the metric with the tags extracted from ctx,
+// see WithContextTagExtractor, and honors ForceEmit.
+func (c *Client) GaugeCtx(ctx context.Context, stat string, value int, rate float64) error {
+	if value < 0 {
+		return c.sendContext(ctx, TypeGauge, stat, rate, "%v", negativeGauge{value})
+	}
+	return c.sendContext(ctx, TypeGauge, stat, rate, "%d", value)
+}
@@ -0,0 +1,132 @@
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+type traceKey struct{}
+
+func TestIncrCtx(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithContextTagExtractor(func(ctx context.Context) []string {
+		if id, ok := ctx.Value(traceKey{}).(string); ok {
+			return []string{"trace:" + id}
+		}
+		return nil
+	}))
+	err := c.IncrCtx(context.WithValue(context.Background(), traceKey{}, "abc"), "incr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.IncrCtx(context.Background(), "incr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "incr:1|c|#trace:abc\nincr:1|c")
+}
+
+func TestForceEmit(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	ctx := ForceEmit(context.Background())
+	err := c.IncrementCtx(ctx, "incr", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.DurationCtx(ctx, "timing", 350*time.Millisecond, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.IncrementCtx(context.Background(), "incr", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "incr:1|c\ntiming:350|ms")
+}
+
+func TestFlushContext(t *testing.T) {
+	// Writes to a pipe block until the other end reads them.
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	c, err := newClient(conn, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Incr("incr")
+	if err := c.FlushContext(canceled); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.FlushContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	c.Incr("incr")
+	if err := c.FlushContext(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// The connection is usable again once FlushContext returned.
+	packets := make(chan string, 1)
+	go func() {
+		b := make([]byte, 512)
+		n, _ := peer.Read(b)
+		packets <- string(b[:n])
+	}()
+	c.Incr("decr")
+	if err := c.FlushContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, <-packets, "decr:1|c")
+}
+
+func TestWriteTimeout(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Nobody reads the pipe, writes to it time out.
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	c, err := newClient(conn, 0, []Option{WithWriteTimeout(10 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.addr = l.LocalAddr().String()
+
+	c.Incr("incr")
+	err = c.Flush()
+	if err, ok := err.(net.Error); !ok || !err.Timeout() {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+
+	// The client reconnected.
+	c.Incr("decr")
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 512)
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := l.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, string(b[:n]), "decr:1|c")
+}
@@ -0,0 +1,38 @@
+package statsd
+
+import "sync/atomic"
+
+// LocalCounter is a counter aggregated by the client, safe for concurrent use.
+// Additions are accumulated without taking the client lock and
+// their sum is sent as a single metric every time the client is flushed.
+type LocalCounter struct {
+	c    *Client
+	stat string
+	n    int64
+}
+
+// LocalCounter returns a counter for the given bucket aggregated client side.
+func (c *Client) LocalCounter(stat string) *LocalCounter {
+	lc := &LocalCounter{
+		c:    c,
+		stat: stat,
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.collectors = append(c.collectors, collector{stat: stat, collect: lc.collect})
+	return lc
+}
+
+// Add adds n to the counter.
+func (lc *LocalCounter) Add(n int) {
+	atomic.AddInt64(&lc.n, int64(n))
+}
+
+// collect buffers the sum accumulated since the last flush, the client lock must be held.
+func (lc *LocalCounter) collect() error {
+	n := atomic.SwapInt64(&lc.n, 0)
+	if n == 0 {
+		return nil
+	}
+	return lc.c.record(TypeCounter, lc.stat, 1, nil, "%d", n)
+}
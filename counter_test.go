@@ -0,0 +1,32 @@
+package statsd
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestLocalCounter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	lc := c.LocalCounter("incr")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				lc.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	err := c.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, buf.String(), "incr:1000|c")
+	buf.Reset()
+	c.Flush()
+	assert(t, buf.String(), "")
+}
@@ -0,0 +1,123 @@
+package statsd
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// failoverThreshold is the number of consecutive write errors on the primary
+	// endpoint after which metrics are sent to the fallback one.
+	failoverThreshold = 3
+	// probeInterval is how often the primary endpoint is retried once failed over.
+	probeInterval = 30 * time.Second
+	// fallbackTimeout bounds the dial of the fallback endpoint when the client has no timeout.
+	fallbackTimeout = time.Second
+)
+
+// failover writes packets to the primary connection, switching to the fallback address
+// on sustained failure. It is only used under the client lock, except for SetWriteDeadline.
+type failover struct {
+	// m guards the connections and the deadline against SetWriteDeadline,
+	// which is called without the client lock to interrupt a write.
+	m        sync.Mutex
+	primary  net.Conn
+	fallback net.Conn
+	deadline time.Time
+
+	addr     string
+	timeout  time.Duration
+	active   bool
+	failures int
+	failedAt time.Time
+	now      func() time.Time
+}
+
+func newFailover(primary net.Conn, addr string, timeout time.Duration, now func() time.Time) *failover {
+	if timeout <= 0 {
+		timeout = fallbackTimeout
+	}
+	return &failover{
+		primary: primary,
+		addr:    addr,
+		timeout: timeout,
+		now:     now,
+	}
+}
+
+// SetWriteDeadline sets the write deadline of both endpoints, including the
+// fallback one if it is dialed later.
+func (f *failover) SetWriteDeadline(t time.Time) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.deadline = t
+	if f.fallback != nil {
+		f.fallback.SetWriteDeadline(t)
+	}
+	return f.primary.SetWriteDeadline(t)
+}
+
+// setPrimary replaces the primary connection once it has been redialed.
+func (f *failover) setPrimary(conn net.Conn) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.primary = conn
+	conn.SetWriteDeadline(f.deadline)
+}
+
+func (f *failover) Write(p []byte) (int, error) {
+	if f.active {
+		if f.now().Sub(f.failedAt) < probeInterval {
+			return f.fallback.Write(p)
+		}
+		if n, err := f.primary.Write(p); err == nil {
+			debug("primary endpoint is back, leaving fallback %s", f.addr)
+			f.active = false
+			f.failures = 0
+			return n, nil
+		}
+		f.failedAt = f.now()
+		return f.fallback.Write(p)
+	}
+
+	n, err := f.primary.Write(p)
+	if err == nil {
+		f.failures = 0
+		return n, nil
+	}
+	f.failures++
+	if f.failures < failoverThreshold {
+		return n, err
+	}
+	if f.fallback == nil {
+		conn, derr := dialConn(f.primary.RemoteAddr().Network(), f.addr, f.timeout)
+		if derr != nil {
+			return n, err
+		}
+		f.m.Lock()
+		f.fallback = conn
+		conn.SetWriteDeadline(f.deadline)
+		f.m.Unlock()
+	}
+	debug("primary endpoint failed %d times, switching to fallback %s", f.failures, f.addr)
+	f.active = true
+	f.failedAt = f.now()
+	return f.fallback.Write(p)
+}
+
+// Addr returns the address of the endpoint in use.
+func (f *failover) Addr() string {
+	if f.active {
+		return f.fallback.RemoteAddr().String()
+	}
+	return f.primary.RemoteAddr().String()
+}
+
+// Close closes the fallback connection, the primary one is owned by the client.
+func (f *failover) Close() error {
+	if f.fallback == nil {
+		return nil
+	}
+	return f.fallback.Close()
+}
@@ -0,0 +1,115 @@
+package statsd
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// failingConn is a connection whose writes fail while broken is set.
+type failingConn struct {
+	net.Conn
+	broken  bool
+	packets []string
+}
+
+func (c *failingConn) Write(p []byte) (int, error) {
+	if c.broken {
+		return 0, errors.New("connection refused")
+	}
+	c.packets = append(c.packets, string(p))
+	return len(p), nil
+}
+
+func (c *failingConn) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 8125}
+}
+
+func (c *failingConn) Close() error {
+	return nil
+}
+
+func (c *failingConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func TestFailover(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	now := time.Unix(0, 0)
+	primary := &failingConn{broken: true}
+	c, err := newClient(primary, 0, []Option{
+		WithFallbackAddr(l.LocalAddr().String()),
+		WithClock(func() time.Time { return now }),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 1; i < failoverThreshold; i++ {
+		c.Incr("incr")
+		if err := c.Flush(); err == nil {
+			t.Fatalf("%d: expected an error from the primary endpoint", i)
+		}
+	}
+	c.Incr("incr")
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, c.Stats().Addr, l.LocalAddr().String())
+
+	b := make([]byte, 512)
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := l.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, string(b[:n]), "incr:1|c")
+
+	primary.broken = false
+	now = now.Add(probeInterval)
+	c.Incr("incr")
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, c.Stats().Addr, "10.0.0.1:8125")
+	if len(primary.packets) != 1 {
+		t.Fatalf("incorrect number of packets, want 1, got %d", len(primary.packets))
+	}
+	assert(t, primary.packets[0], "incr:1|c")
+}
+
+func TestFailoverWriteTimeout(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c, err := newClient(&failingConn{broken: true}, 0, []Option{
+		WithFallbackAddr(l.LocalAddr().String()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for i := 0; i < failoverThreshold; i++ {
+		c.Incr("incr")
+		c.Flush()
+	}
+	assert(t, c.Stats().Addr, l.LocalAddr().String())
+
+	if err := c.Reconfigure(WithWriteTimeout(time.Nanosecond)); err != nil {
+		t.Fatal(err)
+	}
+	c.Incr("incr")
+	if err := c.Flush(); err == nil {
+		t.Error("expected the write deadline to apply to the fallback endpoint")
+	}
+}
@@ -0,0 +1,63 @@
+package statsd
+
+// GaugeFunc registers a gauge whose value is computed by f every time the client is flushed.
+// f is called without holding the client lock, so it may use the client itself.
+func (c *Client) GaugeFunc(stat string, f func() int) {
+	g := &gaugeFunc{stat: stat, f: f}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.gauges = append(c.gauges, g)
+	c.collectors = append(c.collectors, collector{stat: stat, collect: func() error {
+		if !g.sampled {
+			return nil
+		}
+		g.sampled = false
+		if g.value < 0 {
+			return c.record(TypeGauge, stat, 1, nil, "%v", negativeGauge{g.value})
+		}
+		return c.record(TypeGauge, stat, 1, nil, "%d", g.value)
+	}})
+}
+
+// gaugeFunc holds the last value computed for a GaugeFunc until it is buffered by its collector.
+type gaugeFunc struct {
+	stat    string
+	f       func() int
+	value   int
+	sampled bool
+}
+
+// sampleGauges computes the value of the gauges registered by GaugeFunc, or of the gauges
+// named stat if it is not empty. The functions are called without holding the lock,
+// the lock must be held by the caller when it returns.
+func (c *Client) sampleGauges(stat string) {
+	c.m.Lock()
+	gauges := make([]*gaugeFunc, 0, len(c.gauges))
+	for _, g := range c.gauges {
+		if stat == "" || g.stat == stat {
+			gauges = append(gauges, g)
+		}
+	}
+	c.m.Unlock()
+
+	values := make([]int, len(gauges))
+	for i, g := range gauges {
+		values[i] = g.f()
+	}
+
+	c.m.Lock()
+	for i, g := range gauges {
+		g.value, g.sampled = values[i], true
+	}
+}
+
+// Heartbeat registers a gauge reporting the current unix time every time the client is flushed,
+// a stale value means the process stopped reporting.
+// The time is read from the client clock, see WithClock.
+func (c *Client) Heartbeat(stat string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.collectors = append(c.collectors, collector{stat: stat, collect: func() error {
+		return c.record(TypeGauge, stat, 1, nil, "%d", timestamp(c.now().Unix()))
+	}})
+}
@@ -0,0 +1,65 @@
+package statsd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestGaugeFunc(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	value := 0
+	c.GaugeFunc("gauge", func() int {
+		value++
+		return value
+	})
+	c.Flush()
+	c.Flush()
+	assert(t, buf.String(), "gauge:1|ggauge:2|g")
+}
+
+func TestGaugeFuncNegative(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	c.GaugeFunc("gauge", func() int {
+		return -5
+	})
+	c.Flush()
+	assert(t, buf.String(), "gauge:0|g\ngauge:-5|g")
+}
+
+func TestHeartbeat(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithClock(func() time.Time {
+		return time.Unix(1400000000, 0)
+	}))
+	c.Heartbeat("heartbeat")
+	err := c.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, buf.String(), "heartbeat:1400000000|g")
+}
+
+func TestGaugeFuncUsingClient(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	c.GaugeFunc("gauge", func() int {
+		c.Increment("sampled", 1, 1)
+		return 1
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Flush()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("flush deadlocked")
+	}
+	assert(t, buf.String(), "sampled:1|c\ngauge:1|g")
+}
@@ -0,0 +1,66 @@
+package statsd
+
+import (
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// BucketedHistogram is a histogram aggregated by the client, safe for concurrent use.
+// Observations are counted in buckets without taking the client lock, and every time
+// the client is flushed each bucket is sent as a counter tagged with its upper bound,
+// "le:<bound>", cumulatively as Prometheus does, up to a final "le:+Inf" bucket.
+type BucketedHistogram struct {
+	c          *Client
+	stat       string
+	boundaries []float64
+	counts     []uint64
+}
+
+// BucketedHistogram returns a histogram for the given bucket with the given bucket upper bounds.
+func (c *Client) BucketedHistogram(stat string, boundaries []float64) *BucketedHistogram {
+	bounds := append([]float64(nil), boundaries...)
+	sort.Float64s(bounds)
+	h := &BucketedHistogram{
+		c:          c,
+		stat:       stat,
+		boundaries: bounds,
+		counts:     make([]uint64, len(bounds)+1),
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.collectors = append(c.collectors, collector{stat: stat, collect: h.collect})
+	return h
+}
+
+// Observe counts v in the first bucket whose upper bound is greater than or equal to it.
+func (h *BucketedHistogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.boundaries, v)
+	atomic.AddUint64(&h.counts[i], 1)
+}
+
+// collect buffers the bucket counts accumulated since the last flush, the client lock must be held.
+func (h *BucketedHistogram) collect() error {
+	counts := make([]uint64, len(h.counts))
+	total := uint64(0)
+	for i := range h.counts {
+		counts[i] = atomic.SwapUint64(&h.counts[i], 0)
+		total += counts[i]
+	}
+	if total == 0 {
+		return nil
+	}
+
+	cumulative := uint64(0)
+	for i, count := range counts {
+		cumulative += count
+		le := "+Inf"
+		if i < len(h.boundaries) {
+			le = strconv.FormatFloat(h.boundaries[i], 'g', -1, 64)
+		}
+		if err := h.c.record(TypeCounter, h.stat, 1, []string{"le:" + le}, "%d", observations(cumulative)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package statsd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBucketedHistogram(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	h := c.BucketedHistogram("latency", []float64{100, 10})
+	h.Observe(5)
+	h.Observe(10)
+	h.Observe(50)
+	h.Observe(500)
+	err := c.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, buf.String(), "latency:2|c|#le:10\nlatency:3|c|#le:100\nlatency:4|c|#le:+Inf")
+	buf.Reset()
+	c.Flush()
+	assert(t, buf.String(), "")
+}
+
+func TestBucketedHistogramScale(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithScale(TypeCounter, 2))
+	h := c.BucketedHistogram("latency", []float64{1})
+	h.Observe(1)
+	c.Incr("requests")
+	c.Flush()
+	assert(t, buf.String(), "requests:2|c\nlatency:1|c|#le:1\nlatency:1|c|#le:+Inf")
+}
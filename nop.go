@@ -0,0 +1,78 @@
+package statsd
+
+import (
+	"context"
+	"io/ioutil"
+	"time"
+)
+
+// Statter is the set of methods used to send and flush metrics, implemented by
+// Client, including the clients returned by NewNop. Code depending on it can be
+// given a real client or a no-op one. The methods configuring the client or
+// returning client specific types, such as Batch or LocalCounter, are left out.
+type Statter interface {
+	Increment(stat string, count int, rate float64) error
+	IncrementTags(stat string, count int, rate float64, tags map[string]string) error
+	Incr(stat string) error
+	IncrBy(stat string, n int) error
+	Decrement(stat string, count int, rate float64) error
+	DecrementTags(stat string, count int, rate float64, tags map[string]string) error
+	Decr(stat string) error
+	DecrBy(stat string, value int) error
+	ResetCounter(stat string) error
+	Duration(stat string, duration time.Duration, rate float64) error
+	DurationTags(stat string, duration time.Duration, rate float64, tags map[string]string) error
+	DurationSince(stat string, t time.Time) error
+	Timing(stat string, delta int, rate float64) error
+	TimingTags(stat string, delta int, rate float64, tags map[string]string) error
+	TimingFloat(stat string, delta float64, rate float64) error
+	TimingFloatTags(stat string, delta float64, rate float64, tags map[string]string) error
+	Time(stat string, rate float64, f func()) error
+	Histogram(stat string, value int, rate float64) error
+	HistogramTags(stat string, value int, rate float64, tags map[string]string) error
+	HistogramFloat(stat string, value float64, rate float64) error
+	HistogramFloatTags(stat string, value float64, rate float64, tags map[string]string) error
+	Distribution(stat string, value float64, rate float64) error
+	DistributionTags(stat string, value float64, rate float64, tags map[string]string) error
+	Gauge(stat string, value int, rate float64) error
+	GaugeTags(stat string, value int, rate float64, tags map[string]string) error
+	GaugeFloat(stat string, value float64, rate float64) error
+	GaugeFloatTags(stat string, value float64, rate float64, tags map[string]string) error
+	IncrementGauge(stat string, value int, rate float64) error
+	IncrementGaugeTags(stat string, value int, rate float64, tags map[string]string) error
+	IncrementGaugeBy(stat string, value int) error
+	DecrementGauge(stat string, value int, rate float64) error
+	DecrementGaugeTags(stat string, value int, rate float64, tags map[string]string) error
+	DecrementGaugeBy(stat string, value int) error
+	IncrementGaugeFloat(stat string, value float64, rate float64) error
+	IncrementGaugeFloatTags(stat string, value float64, rate float64, tags map[string]string) error
+	DecrementGaugeFloat(stat string, value float64, rate float64) error
+	DecrementGaugeFloatTags(stat string, value float64, rate float64, tags map[string]string) error
+	Unique(stat string, value int, rate float64) error
+	UniqueTags(stat string, value int, rate float64, tags map[string]string) error
+	UniqueString(stat string, value string, rate float64) error
+	UniqueStringTags(stat string, value string, rate float64, tags map[string]string) error
+	Annotate(name string, value string, args ...interface{}) error
+	IncrementCtx(ctx context.Context, stat string, count int, rate float64) error
+	IncrCtx(ctx context.Context, stat string) error
+	DurationCtx(ctx context.Context, stat string, duration time.Duration, rate float64) error
+	TimingCtx(ctx context.Context, stat string, delta int, rate float64) error
+	GaugeCtx(ctx context.Context, stat string, value int, rate float64) error
+	NewTimer(stat string, rate float64) *Timer
+	Flush() error
+	FlushN() (n int, err error)
+	FlushContext(ctx context.Context) error
+	Close() error
+	Shutdown(ctx context.Context) error
+}
+
+var _ Statter = (*Client)(nil)
+
+// NewNop returns a client that sends nothing, for environments where metrics are
+// disabled and for tests. Its methods never fail, even once it has been closed.
+// Scoped clients derived from it with WithPrefix send nothing either.
+func NewNop() *Client {
+	c := NewClient(ioutil.Discard)
+	c.nop = true
+	return c
+}
@@ -0,0 +1,60 @@
+package statsd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNop(t *testing.T) {
+	var s Statter = NewNop()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		s.Incr("incr"),
+		s.Incr(strings.Repeat("a", defaultBufSize)),
+		s.Duration("duration", time.Second, 1),
+		s.Gauge("gauge", -1, 1),
+		s.UniqueString("unique", "user\n1", 1),
+		s.NewTimer("timer", 1).Send(),
+		s.IncrCtx(context.Background(), "incr"),
+		s.Annotate("annotation", "deploy %s", "v1"),
+		s.Flush(),
+		s.Shutdown(context.Background()),
+		s.Close(),
+	} {
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+
+	c := NewNop().WithPrefix("api.")
+	for _, err := range []error{
+		c.RegisterMetric("a", TypeCounter),
+		c.RegisterMetric("a", TypeGauge),
+		c.Reconfigure(WithBufferSize(10)),
+	} {
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	b := c.Batch()
+	b.Incr("incr")
+	if err := b.Send(); err != nil {
+		t.Error(err)
+	}
+	if n, err := c.FlushN(); n != 0 || err != nil {
+		t.Errorf("expected nothing flushed, got %d, %v", n, err)
+	}
+}
+
+func TestNopFlushEvery(t *testing.T) {
+	c := NewNop()
+	c.FlushEvery(time.Millisecond)
+	if len(c.stops) != 0 {
+		t.Error("expected no background flush on a nop client")
+	}
+	c.Close()
+}
@@ -0,0 +1,374 @@
+package statsd
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// defaultMTU is the largest UDP payload that fits in a 1500 bytes Ethernet frame
+// without fragmentation, once IP and UDP headers are accounted for.
+const defaultMTU = 1432
+
+// Option configures a Client.
+type Option func(*config)
+
+type config struct {
+	network          string
+	timeout          time.Duration
+	bufSize          int
+	flushInterval    time.Duration
+	writeTimeout     time.Duration
+	asyncSize        int
+	prefix           string
+	defaultTags      map[string]string
+	adaptiveTarget   int
+	sequence         bool
+	maxBytes         int
+	maxAge           time.Duration
+	tagExtractor     func(context.Context) []string
+	mtu              int
+	strictMTU        bool
+	strict           bool
+	strictNames      bool
+	specs            bool
+	strictRegistry   bool
+	omitRate         map[MetricType]bool
+	preciseDurations bool
+	legacyHistogram  bool
+	scale            map[MetricType]float64
+	fallbackAddr     string
+	pushURL          string
+	pushJob          string
+	promMapping      map[MetricType]PrometheusType
+	promBuckets      []float64
+	logger           *log.Logger
+	now              func() time.Time
+}
+
+// staticConfig holds the settings that can't be changed once the client is created.
+type staticConfig struct {
+	network       string
+	timeout       time.Duration
+	bufSize       int
+	flushInterval time.Duration
+	asyncSize     int
+	mtu           int
+	strictMTU     bool
+	fallbackAddr  string
+	pushURL       string
+	pushJob       string
+	promMapping   map[MetricType]PrometheusType
+	promBuckets   []float64
+}
+
+func (cfg config) static() staticConfig {
+	return staticConfig{
+		network:       cfg.network,
+		timeout:       cfg.timeout,
+		bufSize:       cfg.bufSize,
+		flushInterval: cfg.flushInterval,
+		asyncSize:     cfg.asyncSize,
+		mtu:           cfg.mtu,
+		strictMTU:     cfg.strictMTU,
+		fallbackAddr:  cfg.fallbackAddr,
+		pushURL:       cfg.pushURL,
+		pushJob:       cfg.pushJob,
+		promMapping:   cfg.promMapping,
+		promBuckets:   cfg.promBuckets,
+	}
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{
+		network: "udp",
+		mtu:     defaultMTU,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithNetwork sets the network New connects on, as understood by net.Dial, "udp" by default.
+// Metrics sent over stream networks such as "tcp" are newline terminated.
+func WithNetwork(network string) Option {
+	return func(cfg *config) {
+		cfg.network = network
+	}
+}
+
+// WithTimeout bounds the time New waits for the connection, including name resolution.
+// There is no timeout by default.
+func WithTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.timeout = d
+	}
+}
+
+// WithBufferSize sets the packet size, 512 bytes by default,
+// see https://github.com/etsy/statsd/blob/master/docs/metric_types.md#multi-metric-packets for guidelines.
+func WithBufferSize(n int) Option {
+	return func(cfg *config) {
+		cfg.bufSize = n
+	}
+}
+
+// WithWriteTimeout bounds the time writing a packet to the connection can take.
+// A write timing out fails the flush, the packet is dropped and the client
+// reconnects. There is no timeout by default.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.writeTimeout = d
+	}
+}
+
+// WithFlushInterval flushes the buffer every d in the background, see Client.FlushEvery.
+func WithFlushInterval(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.flushInterval = d
+	}
+}
+
+// WithAsync makes sending a metric queue it for a background worker, which owns
+// the buffer and records the metrics, so that callers never wait for the client lock.
+// Metrics sent while queueSize metrics are already waiting are dropped and counted
+// in Stats. Errors are not reported to callers, and metrics stay buffered until
+// the buffer is full or flushed, see WithFlushInterval. Flush and Close record
+// the queued metrics before flushing.
+func WithAsync(queueSize int) Option {
+	return func(cfg *config) {
+		cfg.asyncSize = queueSize
+	}
+}
+
+// WithPrefix sets the prefix added to every stat string, see Client.Prefix.
+func WithPrefix(prefix string) Option {
+	return func(cfg *config) {
+		cfg.prefix = prefix
+	}
+}
+
+// WithTags sets the tags appended to every metric, see Client.SetTags.
+// tags is copied, later changes to it don't affect the client.
+func WithTags(tags map[string]string) Option {
+	copied := make(map[string]string, len(tags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+	return func(cfg *config) {
+		cfg.defaultTags = copied
+	}
+}
+
+// WithAdaptiveSampling makes the client tune the sample rate of every bucket
+// so that each one emits roughly targetPerSecond metrics per second.
+// Rare buckets are sent at full rate while hot ones are sampled down,
+// the rate given to the metric methods is ignored.
+func WithAdaptiveSampling(targetPerSecond int) Option {
+	return func(cfg *config) {
+		cfg.adaptiveTarget = targetPerSecond
+	}
+}
+
+// WithSequenceTracking appends a monotonically increasing "seq" tag to every
+// metric sent, so that a collector can detect gaps caused by packet loss.
+// It costs around a dozen bytes per metric, leaving less room for metrics in
+// each packet, and requires a collector that understands DogStatsD tags.
+func WithSequenceTracking() Option {
+	return func(cfg *config) {
+		cfg.sequence = true
+	}
+}
+
+// WithMaxBytes flushes the buffer as soon as it holds at least n bytes,
+// even though more metrics would still fit in the packet.
+// The packet size always takes precedence: a metric that would not fit
+// in the current packet flushes the buffer before being added to it.
+func WithMaxBytes(n int) Option {
+	return func(cfg *config) {
+		cfg.maxBytes = n
+	}
+}
+
+// WithMaxAge bounds the time a metric can stay buffered, the buffer is flushed
+// once its oldest metric is older than d, whichever of the size limits is hit first.
+// Clients connected by New default to 100ms, zero keeps the metrics buffered
+// until the packet is full or the client is flushed.
+func WithMaxAge(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.maxAge = d
+	}
+}
+
+// WithContextTagExtractor sets the function used by the context aware methods,
+// such as IncrCtx, to derive tags from a request context.
+// Tags are returned in their wire form, "key:value" or "key".
+// It runs on every call, keep it cheap.
+func WithContextTagExtractor(f func(context.Context) []string) Option {
+	return func(cfg *config) {
+		cfg.tagExtractor = f
+	}
+}
+
+// WithMTU sets the largest UDP packet size considered safe from fragmentation,
+// 1432 by default. Dialing with a larger packet size logs a warning.
+func WithMTU(size int) Option {
+	return func(cfg *config) {
+		cfg.mtu = size
+	}
+}
+
+// WithStrictMTU makes dialing with a packet size larger than the MTU fail instead of logging a warning.
+func WithStrictMTU() Option {
+	return func(cfg *config) {
+		cfg.strictMTU = true
+	}
+}
+
+// WithLogger sets the logger used to report misconfigurations, the standard logger by default.
+func WithLogger(l *log.Logger) Option {
+	return func(cfg *config) {
+		cfg.logger = l
+	}
+}
+
+// WithClock sets the function the client reads the current time from, time.Now by default.
+func WithClock(now func() time.Time) Option {
+	return func(cfg *config) {
+		cfg.now = now
+	}
+}
+
+// WithStrictValidation checks every metric against the statsd grammar before buffering it,
+// returning an error for malformed ones. It is meant to catch instrumentation bugs
+// in tests and staging, its cost makes it unsuitable for production.
+func WithStrictValidation() Option {
+	return func(cfg *config) {
+		cfg.strict = true
+	}
+}
+
+// WithLegacyHistogram sends histograms as timers, with the "ms" type,
+// for servers that don't support the "h" type.
+func WithLegacyHistogram() Option {
+	return func(cfg *config) {
+		cfg.legacyHistogram = true
+	}
+}
+
+// WithStrictNames rejects metrics whose bucket name, once prefixed, is empty or
+// contains one of the characters delimiting the parts of a metric: ":", "|", "@"
+// or a newline. By default such names are sent as is and corrupt the metric.
+func WithStrictNames() Option {
+	return func(cfg *config) {
+		cfg.strictNames = true
+	}
+}
+
+// WithoutSampleRate stops appending the "|@rate" suffix to sampled metrics of the given types,
+// for servers that reject it. Those metrics are still sampled, but the server can no longer
+// scale them back up.
+func WithoutSampleRate(types ...MetricType) Option {
+	return func(cfg *config) {
+		omit := make(map[MetricType]bool, len(cfg.omitRate)+len(types))
+		for typ := range cfg.omitRate {
+			omit[typ] = true
+		}
+		for _, typ := range types {
+			omit[typ] = true
+		}
+		cfg.omitRate = omit
+	}
+}
+
+// WithPushgateway mirrors every metric sent to a Prometheus pushgateway at addr,
+// such as "http://localhost:9091", grouped under the given job.
+// Metrics are still sent to statsd, and pushed to the gateway on every Flush.
+//
+// By default counters become Prometheus counters, gauges become gauges and
+// timers become histograms, see WithPrometheusType and WithPrometheusBuckets.
+// Bucket names are converted to Prometheus names by replacing invalid characters
+// with underscores, tags are not pushed.
+func WithPushgateway(addr, job string) Option {
+	return func(cfg *config) {
+		cfg.pushURL = addr
+		cfg.pushJob = job
+	}
+}
+
+// WithPrometheusType sets the Prometheus type metrics of the given statsd type are pushed as.
+// An empty type stops pushing them.
+func WithPrometheusType(typ MetricType, kind PrometheusType) Option {
+	return func(cfg *config) {
+		mapping := make(map[MetricType]PrometheusType, len(cfg.promMapping)+1)
+		for t, k := range cfg.promMapping {
+			mapping[t] = k
+		}
+		mapping[typ] = kind
+		cfg.promMapping = mapping
+	}
+}
+
+// WithPrometheusBuckets sets the upper bounds of the buckets of pushed histograms,
+// in increasing order and in the unit of the metrics, milliseconds for timers.
+func WithPrometheusBuckets(buckets []float64) Option {
+	return func(cfg *config) {
+		cfg.promBuckets = buckets
+	}
+}
+
+// WithMetricSpecs makes the client parse bucket names as metric specs, see ParseSpec,
+// so that "requests@0.1" is sent to the "requests" bucket at a rate of 0.1.
+// A rate set by the spec overrides the one given to the metric method,
+// and a malformed spec is returned as an error.
+func WithMetricSpecs() Option {
+	return func(cfg *config) {
+		cfg.specs = true
+	}
+}
+
+// WithFallbackAddr sets a backup endpoint metrics are sent to after repeated
+// write failures on the primary one. While failed over, the primary endpoint
+// is retried every 30 seconds and used again as soon as it accepts writes.
+func WithFallbackAddr(addr string) Option {
+	return func(cfg *config) {
+		cfg.fallbackAddr = addr
+	}
+}
+
+// WithStrictRegistry rejects metrics that haven't been declared with RegisterMetric,
+// to catch typos in metric names.
+func WithStrictRegistry() Option {
+	return func(cfg *config) {
+		cfg.strictRegistry = true
+	}
+}
+
+// WithScale multiplies the values of every metric of the given type by factor before
+// sending them, to convert units in a single place: WithScale(TypeTimer, 0.001) turns
+// timings recorded in microseconds into milliseconds. It applies to every method
+// sending that type, Duration included. Integer values are rounded to the nearest
+// integer, halves away from zero. Sets and annotations are never scaled.
+func WithScale(typ MetricType, factor float64) Option {
+	return func(cfg *config) {
+		if typ == TypeSet || typ == TypeAnnotation {
+			return
+		}
+		scale := make(map[MetricType]float64, len(cfg.scale)+1)
+		for t, f := range cfg.scale {
+			scale[t] = f
+		}
+		scale[typ] = factor
+		cfg.scale = scale
+	}
+}
+
+// WithPreciseDurations keeps the sub-millisecond precision of the durations sent
+// by Duration and its variants, "1.5|ms" instead of the default truncated "1|ms".
+func WithPreciseDurations() Option {
+	return func(cfg *config) {
+		cfg.preciseDurations = true
+	}
+}
@@ -0,0 +1,73 @@
+package statsd
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReconfigure(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithPrefix("api."), WithTags(map[string]string{"env": "staging"}))
+	c.Incr("incr")
+	err := c.Reconfigure(WithPrefix("worker."), WithTags(map[string]string{"env": "production"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Incr("incr")
+	if err := c.Reconfigure(WithPrefix("foo."), WithFallbackAddr("127.0.0.1:8126")); err == nil {
+		t.Error("expected an error changing a static option")
+	}
+	c.Incr("incr")
+	c.Flush()
+	assert(t, buf.String(), "api.incr:1|c|#env:staging\nworker.incr:1|c|#env:production\nworker.incr:1|c|#env:production")
+}
+
+func TestNew(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c, err := New(l.LocalAddr().String(),
+		WithNetwork("udp4"),
+		WithTimeout(time.Second),
+		WithBufferSize(1024),
+		WithPrefix("api."),
+		WithFlushInterval(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.BufferSize() != 1024 {
+		t.Errorf("expected a packet size of 1024, got %d", c.BufferSize())
+	}
+
+	c.Incr("incr")
+	b := make([]byte, 1024)
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := l.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, string(b[:n]), "api.incr:1|c")
+}
+
+func TestDialOptions(t *testing.T) {
+	opts := make([]Option, 1, 2)
+	opts[0] = WithPrefix("api.")
+	c, err := DialSize("127.0.0.1:8125", 1024, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.BufferSize() != 1024 {
+		t.Errorf("expected a packet size of 1024, got %d", c.BufferSize())
+	}
+	if opts[:2][1] != nil {
+		t.Error("expected the caller options to be left untouched")
+	}
+}
@@ -0,0 +1,195 @@
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrometheusType is the type of the Prometheus metric a statsd metric is mapped to.
+type PrometheusType string
+
+// Prometheus metric types statsd metrics can be mapped to.
+const (
+	PrometheusCounter   PrometheusType = "counter"
+	PrometheusGauge     PrometheusType = "gauge"
+	PrometheusHistogram PrometheusType = "histogram"
+)
+
+// defaultPrometheusMapping maps counters to Prometheus counters, gauges to gauges,
+// and timers, distributions and histograms to histograms.
+// Sets and annotations have no Prometheus equivalent and are not pushed.
+var defaultPrometheusMapping = map[MetricType]PrometheusType{
+	TypeCounter:      PrometheusCounter,
+	TypeGauge:        PrometheusGauge,
+	TypeTimer:        PrometheusHistogram,
+	TypeDistribution: PrometheusHistogram,
+	TypeHistogram:    PrometheusHistogram,
+}
+
+// defaultPrometheusBuckets are the histogram buckets used for timers, in milliseconds.
+var defaultPrometheusBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+const pushTimeout = 5 * time.Second
+
+type promMetric struct {
+	kind    PrometheusType
+	value   float64
+	buckets []float64
+	sum     float64
+	count   float64
+}
+
+// pusher mirrors the metrics sent by a client in Prometheus form and pushes them to a pushgateway.
+// Its state is guarded by the client lock, only push may be called without holding it.
+type pusher struct {
+	url     string
+	mapping map[MetricType]PrometheusType
+	buckets []float64
+	client  *http.Client
+	metrics map[string]*promMetric
+}
+
+func newPusher(cfg config) *pusher {
+	mapping := make(map[MetricType]PrometheusType, len(defaultPrometheusMapping))
+	for typ, kind := range defaultPrometheusMapping {
+		mapping[typ] = kind
+	}
+	for typ, kind := range cfg.promMapping {
+		mapping[typ] = kind
+	}
+	buckets := cfg.promBuckets
+	if len(buckets) == 0 {
+		buckets = defaultPrometheusBuckets
+	}
+	return &pusher{
+		url:     strings.TrimSuffix(cfg.pushURL, "/") + "/metrics/job/" + url.PathEscape(cfg.pushJob),
+		mapping: mapping,
+		buckets: buckets,
+		client:  &http.Client{Timeout: pushTimeout},
+		metrics: make(map[string]*promMetric),
+	}
+}
+
+// observe records a sent metric. Counters accumulate their values scaled by the sample rate,
+// gauges follow statsd semantics where a signed value is a delta,
+// and histograms count each value in its bucket.
+func (p *pusher) observe(typ MetricType, stat string, rate float64, value string) {
+	kind := p.mapping[typ]
+	if kind == "" {
+		return
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return
+	}
+	if rate <= 0 || rate > 1 {
+		rate = 1
+	}
+
+	name := promName(stat)
+	m, ok := p.metrics[name]
+	if !ok {
+		m = &promMetric{kind: kind}
+		if kind == PrometheusHistogram {
+			m.buckets = make([]float64, len(p.buckets))
+		}
+		p.metrics[name] = m
+	}
+	if m.kind != kind {
+		// The name is already used by a metric of another type.
+		return
+	}
+
+	switch kind {
+	case PrometheusCounter:
+		// Prometheus counters can't go down, decrements are dropped.
+		if v > 0 {
+			m.value += v / rate
+		}
+	case PrometheusGauge:
+		if typ == TypeGauge && (value[0] == '+' || value[0] == '-') {
+			m.value += v
+		} else {
+			m.value = v
+		}
+	case PrometheusHistogram:
+		for i, bound := range p.buckets {
+			if v <= bound {
+				m.buckets[i] += 1 / rate
+				break
+			}
+		}
+		m.sum += v / rate
+		m.count += 1 / rate
+	}
+}
+
+// render serializes the metrics in the Prometheus text exposition format.
+func (p *pusher) render() []byte {
+	names := make([]string, 0, len(p.metrics))
+	for name := range p.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := new(bytes.Buffer)
+	for _, name := range names {
+		m := p.metrics[name]
+		fmt.Fprintf(buf, "# TYPE %s %s\n", name, m.kind)
+		if m.kind != PrometheusHistogram {
+			fmt.Fprintf(buf, "%s %s\n", name, promValue(m.value))
+			continue
+		}
+		cumulative := 0.0
+		for i, bound := range p.buckets {
+			cumulative += m.buckets[i]
+			fmt.Fprintf(buf, "%s_bucket{le=\"%s\"} %s\n", name, promValue(bound), promValue(cumulative))
+		}
+		fmt.Fprintf(buf, "%s_bucket{le=\"+Inf\"} %s\n", name, promValue(m.count))
+		fmt.Fprintf(buf, "%s_sum %s\n", name, promValue(m.sum))
+		fmt.Fprintf(buf, "%s_count %s\n", name, promValue(m.count))
+	}
+	return buf.Bytes()
+}
+
+// push replaces the metrics of the job on the pushgateway with body.
+func (p *pusher) push(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("statsd: pushgateway returned %s", resp.Status)
+	}
+	return nil
+}
+
+// promName turns a statsd bucket name into a valid Prometheus metric name,
+// "api.requests" becomes "api_requests".
+func promName(stat string) string {
+	b := []byte(stat)
+	for i, ch := range b {
+		valid := ch == '_' || ch == ':' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || (i > 0 && '0' <= ch && ch <= '9')
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func promValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,79 @@
+package statsd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPromName(t *testing.T) {
+	assert(t, promName("api.requests-total"), "api_requests_total")
+	assert(t, promName("5xx"), "_xx")
+}
+
+func TestPushgateway(t *testing.T) {
+	var method, path, body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(b)
+	}))
+	defer ts.Close()
+
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithPushgateway(ts.URL, "api"), WithPrometheusBuckets([]float64{100, 500}))
+	c.Incr("requests")
+	c.IncrBy("requests", 2)
+	c.Gauge("workers", 10, 1)
+	c.DecrementGauge("workers", 3, 1)
+	c.Timing("latency", 50, 1)
+	c.Timing("latency", 300, 1)
+	c.Timing("latency", 900, 1)
+	c.Unique("users", 765, 1)
+	err := c.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert(t, buf.String(), "requests:1|c\nrequests:2|c\nworkers:10|g\nworkers:-3|g\nlatency:50|ms\nlatency:300|ms\nlatency:900|ms\nusers:765|s")
+	assert(t, method, "PUT")
+	assert(t, path, "/metrics/job/api")
+	assert(t, body, `# TYPE latency histogram
+latency_bucket{le="100"} 1
+latency_bucket{le="500"} 2
+latency_bucket{le="+Inf"} 3
+latency_sum 1250
+latency_count 3
+# TYPE requests counter
+requests 3
+# TYPE workers gauge
+workers 7
+`)
+}
+
+func TestPushgatewayError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	c := NewClient(ioutil.Discard, WithPushgateway(ts.URL, "api"))
+	c.Incr("requests")
+	if err := c.Flush(); err == nil {
+		t.Error("expected an error from the pushgateway")
+	}
+}
+
+func TestPushgatewayRejected(t *testing.T) {
+	c := NewClient(new(bytes.Buffer), WithPushgateway("http://127.0.0.1:0", "api"), WithStrictValidation())
+	if err := c.Increment(strings.Repeat("a", defaultBufSize), 5, 1); err == nil {
+		t.Error("expected an error for an oversized metric")
+	}
+	if err := c.Gauge("workers|c", 1, 1); err == nil {
+		t.Error("expected an error for an invalid metric")
+	}
+	c.Incr("requests")
+	assert(t, string(c.pusher.render()), "# TYPE requests counter\nrequests 1\n")
+}
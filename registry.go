@@ -0,0 +1,79 @@
+package statsd
+
+import (
+	"fmt"
+	"sort"
+)
+
+// maxUnregistered bounds the number of metrics registered on the fly, so that
+// the registry doesn't grow with the number of distinct names ever sent.
+const maxUnregistered = 1000
+
+// registry tracks the metrics known to a client, it is guarded by the client lock.
+type registry struct {
+	metrics map[string]MetricType
+	unknown map[string]bool
+}
+
+func newRegistry() *registry {
+	return &registry{
+		metrics: make(map[string]MetricType),
+		unknown: make(map[string]bool),
+	}
+}
+
+// RegisterMetric declares a metric the client is allowed to send, with its type.
+// Once a metric has been registered, or WithStrictRegistry is set, every metric
+// sent is checked against the registry: in strict mode metrics that weren't
+// registered with the type they're sent as are rejected with an error, otherwise
+// they are registered on the fly and reported by Stats, up to 1000 of them.
+// Names are checked before the client prefix is applied.
+func (c *Client) RegisterMetric(name string, typ MetricType) error {
+	if c.nop {
+		return nil
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.registry == nil {
+		c.registry = newRegistry()
+	}
+	if t, ok := c.registry.metrics[name]; ok && t != typ {
+		return fmt.Errorf("statsd: metric %q already registered with type %q", name, t)
+	}
+	c.registry.metrics[name] = typ
+	return nil
+}
+
+// checkRegistered checks a metric against the registry, the lock must be held.
+func (c *Client) checkRegistered(typ MetricType, stat string) error {
+	if c.registry == nil {
+		return nil
+	}
+	t, ok := c.registry.metrics[stat]
+	if ok && t == typ {
+		return nil
+	}
+	if c.strictRegistry {
+		return fmt.Errorf("statsd: metric %q of type %q is not registered", stat, typ)
+	}
+	c.effect(func() {
+		if !c.registry.unknown[stat] && len(c.registry.unknown) >= maxUnregistered {
+			return
+		}
+		if _, ok := c.registry.metrics[stat]; !ok {
+			c.registry.metrics[stat] = typ
+		}
+		c.registry.unknown[stat] = true
+	})
+	return nil
+}
+
+// unregistered returns the sorted names of the metrics sent without being registered.
+func (r *registry) unregistered() []string {
+	names := make([]string, 0, len(r.unknown))
+	for name := range r.unknown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,61 @@
+package statsd
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestStrictRegistry(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithStrictRegistry())
+	err := c.RegisterMetric("requests", TypeCounter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RegisterMetric("requests", TypeGauge); err == nil {
+		t.Error("expected an error registering a metric twice with another type")
+	}
+	if err := c.Incr("requets"); err == nil {
+		t.Error("expected an error for an unregistered metric")
+	}
+	if err := c.Gauge("requests", 1, 1); err == nil {
+		t.Error("expected an error for a metric of the wrong type")
+	}
+	err = c.Incr("requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "requests:1|c")
+}
+
+func TestRegistry(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	c.RegisterMetric("requests", TypeCounter)
+	c.Incr("requests")
+	c.Incr("requets")
+	c.Gauge("requests", 1, 1)
+	c.Flush()
+	assert(t, buf.String(), "requests:1|c\nrequets:1|c\nrequests:1|g")
+	control := []string{"requests", "requets"}
+	if unregistered := c.Stats().Unregistered; !reflect.DeepEqual(unregistered, control) {
+		t.Errorf("incorrect unregistered metrics, want %v, got %v", control, unregistered)
+	}
+}
+
+func TestRegistryBounded(t *testing.T) {
+	c := NewClient(new(bytes.Buffer))
+	c.RegisterMetric("requests", TypeCounter)
+	for i := 0; i < maxUnregistered+10; i++ {
+		c.Incr(fmt.Sprintf("requests.%d", i))
+	}
+	if n := len(c.Stats().Unregistered); n != maxUnregistered {
+		t.Errorf("want %d unregistered metrics, got %d", maxUnregistered, n)
+	}
+	if n := len(c.registry.metrics); n != maxUnregistered+1 {
+		t.Errorf("want %d known metrics, got %d", maxUnregistered+1, n)
+	}
+}
@@ -0,0 +1,77 @@
+package statsd
+
+import (
+	"math/rand"
+	"time"
+)
+
+// SetRandSource sets the source of the random numbers used for sampling.
+// Every client has its own source, seeded with the current time by default,
+// a fixed seed makes sampling deterministic.
+func (c *Client) SetRandSource(src rand.Source) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.rand = rand.New(src)
+}
+
+// adaptiveWindow is the period over which the emission rate of a bucket is measured.
+const adaptiveWindow = time.Second
+
+type bucketRate struct {
+	count int
+	start time.Time
+	rate  float64
+}
+
+// adaptiveSampler computes per bucket sample rates from the observed volume.
+// Buckets idle for a whole window are forgotten, so that the sampler doesn't
+// grow with the number of distinct bucket names ever sent.
+type adaptiveSampler struct {
+	target  int
+	window  time.Duration
+	buckets map[string]*bucketRate
+	swept   time.Time
+}
+
+func newAdaptiveSampler(target int) *adaptiveSampler {
+	return &adaptiveSampler{
+		target:  target,
+		window:  adaptiveWindow,
+		buckets: make(map[string]*bucketRate),
+	}
+}
+
+// rate records a call for the given bucket and returns the sample rate to apply to it.
+// The rate is recomputed once per window from the number of calls seen during the previous one.
+func (s *adaptiveSampler) rate(stat string, now time.Time) float64 {
+	if now.Sub(s.swept) >= s.window {
+		s.sweep(now)
+	}
+	b, ok := s.buckets[stat]
+	if !ok {
+		b = &bucketRate{start: now, rate: 1}
+		s.buckets[stat] = b
+	}
+	if elapsed := now.Sub(b.start); elapsed >= s.window {
+		observed := float64(b.count) / elapsed.Seconds()
+		b.rate = 1
+		if observed > float64(s.target) {
+			b.rate = float64(s.target) / observed
+		}
+		b.count = 0
+		b.start = now
+	}
+	b.count++
+	return b.rate
+}
+
+// sweep forgets the buckets that received no call during the last window.
+// Their window started at least two windows ago, as a call after the first one starts a new one.
+func (s *adaptiveSampler) sweep(now time.Time) {
+	for stat, b := range s.buckets {
+		if now.Sub(b.start) >= 2*s.window {
+			delete(s.buckets, stat)
+		}
+	}
+	s.swept = now
+}
@@ -0,0 +1,83 @@
+package statsd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// floatSource makes rand.Float64 return the given values in turn.
+type floatSource struct {
+	values []float64
+}
+
+func (s *floatSource) Int63() int64 {
+	v := s.values[0]
+	s.values = append(s.values[1:], v)
+	return int64(v * (1 << 63))
+}
+
+func (s *floatSource) Seed(int64) {}
+
+func TestSetRandSource(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	c.SetRandSource(&floatSource{values: []float64{0.25, 0.75, 0.4, 0.5}})
+	for i := 1; i <= 4; i++ {
+		err := c.Increment("incr", i, 0.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Flush()
+	assert(t, buf.String(), "incr:1|c|@0.5\nincr:3|c|@0.5")
+}
+
+func TestAdaptiveSamplerRate(t *testing.T) {
+	s := newAdaptiveSampler(10)
+	now := time.Unix(0, 0)
+	for i := 0; i < 100; i++ {
+		if rate := s.rate("hot", now); rate != 1 {
+			t.Fatalf("incorrect rate, want 1, got %g", rate)
+		}
+	}
+	now = now.Add(time.Second)
+	if rate := s.rate("hot", now); rate != 0.1 {
+		t.Errorf("incorrect rate, want 0.1, got %g", rate)
+	}
+	if rate := s.rate("rare", now); rate != 1 {
+		t.Errorf("incorrect rate, want 1, got %g", rate)
+	}
+	now = now.Add(time.Second)
+	if rate := s.rate("hot", now); rate != 1 {
+		t.Errorf("incorrect rate, want 1, got %g", rate)
+	}
+}
+
+func TestAdaptiveSampling(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithAdaptiveSampling(1000))
+	err := c.Increment("incr", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "incr:1|c")
+}
+
+func TestAdaptiveSamplerEviction(t *testing.T) {
+	s := newAdaptiveSampler(10)
+	now := time.Unix(0, 0)
+	s.rate("idle", now)
+	s.rate("active", now)
+	now = now.Add(time.Second)
+	s.rate("active", now)
+	now = now.Add(time.Second)
+	s.rate("active", now)
+	if _, ok := s.buckets["idle"]; ok {
+		t.Error("expected the idle bucket to be evicted")
+	}
+	if _, ok := s.buckets["active"]; !ok {
+		t.Error("expected the active bucket to be kept")
+	}
+}
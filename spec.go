@@ -0,0 +1,52 @@
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Spec is a metric specification, as parsed by ParseSpec.
+type Spec struct {
+	Name string
+	// Rate is the sample rate set by the spec, 0 when it doesn't set one.
+	Rate float64
+	Tags []string
+}
+
+// ParseSpec parses a metric specification of the form "name[@rate][|#tag,...]",
+// such as "requests@0.1" or "requests|#env:production", so sampling and tags
+// can be configured alongside the bucket name.
+func ParseSpec(spec string) (Spec, error) {
+	var s Spec
+	name := spec
+	if i := strings.IndexByte(name, '|'); i >= 0 {
+		if !strings.HasPrefix(name[i:], "|#") {
+			return s, invalidSpec(spec, "expected tags after '|'")
+		}
+		for _, tag := range strings.Split(name[i+2:], ",") {
+			if tag == "" {
+				return s, invalidSpec(spec, "empty tag")
+			}
+			s.Tags = append(s.Tags, tag)
+		}
+		name = name[:i]
+	}
+	if i := strings.IndexByte(name, '@'); i >= 0 {
+		rate, err := strconv.ParseFloat(name[i+1:], 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return s, invalidSpec(spec, "invalid sample rate")
+		}
+		s.Rate = rate
+		name = name[:i]
+	}
+	if name == "" {
+		return s, invalidSpec(spec, "missing bucket name")
+	}
+	s.Name = name
+	return s, nil
+}
+
+func invalidSpec(spec, reason string) error {
+	return fmt.Errorf("statsd: invalid metric spec %q: %s", spec, reason)
+}
@@ -0,0 +1,64 @@
+package statsd
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var parseSpecTests = []struct {
+	spec    string
+	control Spec
+	valid   bool
+}{
+	{spec: "requests", control: Spec{Name: "requests"}, valid: true},
+	{spec: "requests@0.1", control: Spec{Name: "requests", Rate: 0.1}, valid: true},
+	{spec: "requests|#env:production,canary", control: Spec{Name: "requests", Tags: []string{"env:production", "canary"}}, valid: true},
+	{spec: "requests@0.5|#env:production", control: Spec{Name: "requests", Rate: 0.5, Tags: []string{"env:production"}}, valid: true},
+	{spec: "", valid: false},
+	{spec: "@0.1", valid: false},
+	{spec: "requests@", valid: false},
+	{spec: "requests@2", valid: false},
+	{spec: "requests@0.1@0.2", valid: false},
+	{spec: "requests|env", valid: false},
+	{spec: "requests|#", valid: false},
+	{spec: "requests|#env,,canary", valid: false},
+}
+
+func TestParseSpec(t *testing.T) {
+	for _, st := range parseSpecTests {
+		spec, err := ParseSpec(st.spec)
+		if !st.valid {
+			if err == nil {
+				t.Errorf("%q: expected an error", st.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", st.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(spec, st.control) {
+			t.Errorf("%q: incorrect spec, want %+v, got %+v", st.spec, st.control, spec)
+		}
+	}
+}
+
+func TestMetricSpecs(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithMetricSpecs())
+	err := c.Incr("requests|#env:production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Increment("requests@1", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Incr("requests@x")
+	if err == nil {
+		t.Error("expected an error for a malformed spec")
+	}
+	c.Flush()
+	assert(t, buf.String(), "requests:1|c|#env:production\nrequests:1|c")
+}
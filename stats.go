@@ -0,0 +1,45 @@
+package statsd
+
+import "sync/atomic"
+
+// Stats holds statistics about a client.
+type Stats struct {
+	// Addr is the address of the endpoint metrics are currently sent to,
+	// empty for clients not backed by a connection.
+	Addr string
+	// Unregistered lists the metrics sent without having been registered, see RegisterMetric.
+	// Only the first 1000 of them are tracked.
+	Unregistered []string
+	// Sampled counts the metrics dropped by sampling.
+	Sampled uint64
+	// Dropped counts the metrics dropped because the queue of an asynchronous client was full, see WithAsync.
+	Dropped uint64
+	// FlushErrors counts the packets that failed to be written, along with their metrics.
+	FlushErrors uint64
+	// BytesWritten counts the bytes successfully written to the endpoint.
+	BytesWritten uint64
+}
+
+// Stats returns the current statistics of the client.
+func (c *Client) Stats() Stats {
+	c.m.Lock()
+	defer c.m.Unlock()
+	s := Stats{
+		Sampled:      c.sampled,
+		FlushErrors:  c.flushErrors,
+		BytesWritten: c.bytesWritten,
+	}
+	switch {
+	case c.failover != nil:
+		s.Addr = c.failover.Addr()
+	case c.conn != nil:
+		s.Addr = c.conn.RemoteAddr().String()
+	}
+	if c.async != nil {
+		s.Dropped = atomic.LoadUint64(&c.async.dropped)
+	}
+	if c.registry != nil {
+		s.Unregistered = c.registry.unregistered()
+	}
+	return s
+}
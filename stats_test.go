@@ -0,0 +1,29 @@
+package statsd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStatsCounters(t *testing.T) {
+	w := &errorWriter{}
+	c := NewClient(w)
+	c.SetRandSource(&floatSource{values: []float64{0.75, 0.25}})
+	c.Increment("incr", 1, 0.5)
+	c.Increment("incr", 1, 0.5)
+	c.Flush()
+	w.err = errors.New("connection refused")
+	c.Incr("incr")
+	c.Flush()
+
+	s := c.Stats()
+	if s.Sampled != 1 {
+		t.Errorf("want 1 sampled metric, got %d", s.Sampled)
+	}
+	if s.FlushErrors != 1 {
+		t.Errorf("want 1 flush error, got %d", s.FlushErrors)
+	}
+	if s.BytesWritten != uint64(len("incr:1|c|@0.5")) {
+		t.Errorf("want %d bytes written, got %d", len("incr:1|c|@0.5"), s.BytesWritten)
+	}
+}
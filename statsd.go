@@ -1,86 +1,443 @@
 package statsd
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	. "github.com/visionmedia/go-debug"
 	"io"
+	"log"
+	"math"
 	"math/rand"
 	"net"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var debug = Debug("statsd")
 
+// MetricType is the type of a metric, as found on the wire.
+type MetricType string
+
+// Metric types supported by the client.
+const (
+	TypeCounter      MetricType = "c"
+	TypeTimer        MetricType = "ms"
+	TypeGauge        MetricType = "g"
+	TypeSet          MetricType = "s"
+	TypeAnnotation   MetricType = "a"
+	TypeDistribution MetricType = "d"
+	TypeHistogram    MetricType = "h"
+)
+
+// counterReset is the type ResetCounter emits with: the metric is checked as
+// a counter, then sent as the companion gauge holding the reset time.
+const counterReset MetricType = "reset"
+
 const defaultBufSize = 512
 
+// defaultMaxAge bounds the time a metric stays buffered by the clients connected by New,
+// so that low volume metrics are delivered without calling Flush, see WithMaxAge.
+const defaultMaxAge = 100 * time.Millisecond
+
+const (
+	// minReconnectDelay and maxReconnectDelay bound the backoff between reconnection attempts.
+	minReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay = 10 * time.Second
+	// reconnectTimeout bounds reconnection attempts of clients dialed without a timeout.
+	reconnectTimeout = time.Second
+)
+
+// ErrClosed is returned when sending metrics to a client that has been shut down.
+var ErrClosed = errors.New("statsd: client is closed")
+
 // Client is statsd client representing a connection to a statsd server.
 type Client struct {
-	conn   net.Conn
+	*core
+	// prefix shadows the one of the configuration, so that child clients
+	// created by WithPrefix each have their own.
+	prefix string
+}
+
+// core is the state shared by a client and its children, see Client.WithPrefix.
+type core struct {
+	conn net.Conn
+	// addr is the address the client reconnects to, empty if it wasn't dialed.
+	addr string
+
+	// dialDelay is the current reconnection backoff, no attempt is made before nextDial.
+	dialDelay time.Duration
+	nextDial  time.Time
+
 	m      sync.Mutex
 	w      io.Writer
-	prefix string
+	buf    *bufio.Writer
+	timer  *time.Timer
+	size   int
+	stream bool
+	closed bool
+
+	// tags holds the default tags already serialized, see SetTags.
+	tags string
+
+	// stops stop the background flushes started by FlushEvery.
+	stops   []func()
+	tickers sync.WaitGroup
+
+	// collectors buffer the metrics aggregated client side, they are run on every flush.
+	collectors []collector
+	// gauges are the gauges registered by GaugeFunc, computed before their collector runs.
+	gauges []*gaugeFunc
+
+	config
+	rand     *rand.Rand
+	sampler  *adaptiveSampler
+	pusher   *pusher
+	failover *failover
+	async    *asyncQueue
+	// extractor holds the tag extractor of the config, so that the context aware
+	// methods read it without taking the lock.
+	extractor atomic.Value
+	// ctxDeadline is the deadline of the context given to FlushContext while it runs.
+	ctxDeadline time.Time
+	// batch collects the lines recorded while a Batch is sent, instead of writing them.
+	batch      *batchLines
+	registry   *registry
+	seq        uint64
+	generation uint64
+
+	// nop is set for the clients created by NewNop, which send nothing.
+	nop bool
+
+	// Counters reported by Stats.
+	sampled      uint64
+	flushErrors  uint64
+	bytesWritten uint64
+}
+
+// decimal is a float metric value, formatted without exponent.
+type decimal float64
+
+func (d decimal) String() string {
+	if d == 0 {
+		// Negative zero would be sent with a leading minus sign.
+		return "0"
+	}
+	return strconv.FormatFloat(float64(d), 'f', -1, 64)
+}
+
+// negativeGauge is a gauge value meant to be set as is, rather than as
+// a delta, even though it is negative.
+type negativeGauge struct {
+	value interface{}
+}
+
+// timestamp is a unix time metric value, such as the one of a heartbeat.
+// It is never scaled, see WithScale.
+type timestamp int64
+
+// observations is a number of observations, such as a bucket count of a BucketedHistogram.
+// It is never scaled either, as it isn't expressed in the unit of the metric.
+type observations uint64
+
+// milliseconds is a duration metric value, sent in milliseconds.
+// It is resolved by the client as it depends on WithPreciseDurations.
+type milliseconds time.Duration
+
+// scaleValue multiplies a numeric metric value by factor.
+// Integer values stay integers and are rounded to the nearest one, halves away from zero.
+func scaleValue(v interface{}, factor float64) interface{} {
+	switch v := v.(type) {
+	case int:
+		return int(math.Round(float64(v) * factor))
+	case int64:
+		return int64(math.Round(float64(v) * factor))
+	case uint64:
+		return uint64(math.Round(float64(v) * factor))
+	case decimal:
+		return decimal(float64(v) * factor)
+	}
+	return v
 }
 
 func millisecond(d time.Duration) int {
 	return int(d.Seconds() * 1000)
 }
 
-// Dial connects to the given address on the given network using net.Dial and then returns a new Client for the connection.
-func Dial(addr string) (*Client, error) {
-	conn, err := net.Dial("udp", addr)
+// New connects to the statsd server at addr and returns a new Client for the connection.
+// It connects over UDP unless WithNetwork says otherwise. Addresses starting with
+// "unix://" or "/" are paths of unix datagram sockets, WithNetwork("unix") connects
+// to a unix stream socket instead.
+//
+// Metrics are buffered and sent in packets of up to the packet size, a buffered
+// metric is sent at most 100ms after it was recorded unless WithMaxAge says
+// otherwise. Flush sends the buffered metrics immediately.
+func New(addr string, opts ...Option) (*Client, error) {
+	opts = withOptions([]Option{WithMaxAge(defaultMaxAge)}, opts...)
+	cfg := newConfig(opts)
+	network, addr := unixAddr(cfg.network, addr)
+	conn, err := dialConn(network, addr, cfg.timeout)
 	if err != nil {
 		return nil, err
 	}
-	return newClient(conn, 0), nil
+	c, err := newClient(conn, cfg.bufSize, opts)
+	if err != nil {
+		return nil, err
+	}
+	c.network = network
+	c.addr = addr
+	return c, nil
 }
 
-// NewClient returns a new client with the given writer, useful for testing.
-func NewClient(w io.Writer) *Client {
-	return &Client{
-		w: w,
+// unixAddr detects the addresses of unix sockets, returning the network and path to dial.
+func unixAddr(network, addr string) (string, string) {
+	if !strings.HasPrefix(addr, "unix://") && !strings.HasPrefix(addr, "/") {
+		return network, addr
+	}
+	addr = strings.TrimPrefix(addr, "unix://")
+	switch network {
+	case "unix", "unixgram", "unixpacket":
+		return network, addr
 	}
+	return "unixgram", addr
+}
+
+// Dial connects to the given address on the given network using net.Dial and then returns a new Client for the connection.
+// Metrics are buffered for up to 100ms, see New.
+func Dial(addr string, opts ...Option) (*Client, error) {
+	return New(addr, opts...)
+}
+
+// DialTCP acts like Dial but connects over TCP, metrics are then newline terminated.
+func DialTCP(addr string, opts ...Option) (*Client, error) {
+	return DialNetwork("tcp", addr, opts...)
+}
+
+// DialNetwork acts like Dial but connects on the given network, as understood by net.Dial.
+// Metrics sent over stream networks such as "tcp" are newline terminated.
+func DialNetwork(network, addr string, opts ...Option) (*Client, error) {
+	return New(addr, withOptions(opts, WithNetwork(network))...)
+}
+
+// NewClient returns a new client with the given writer, useful for testing.
+func NewClient(w io.Writer, opts ...Option) *Client {
+	c := &Client{core: newCore(w, defaultBufSize)}
+	c.configure(opts)
+	c.start()
+	return c
 }
 
 // DialTimeout acts like Dial but takes a timeout. The timeout includes name resolution, if required.
-func DialTimeout(addr string, timeout time.Duration) (*Client, error) {
-	conn, err := net.DialTimeout("udp", addr, timeout)
-	if err != nil {
-		return nil, err
-	}
-	return newClient(conn, 0), nil
+func DialTimeout(addr string, timeout time.Duration, opts ...Option) (*Client, error) {
+	return New(addr, withOptions(opts, WithTimeout(timeout))...)
 }
 
 // DialSize acts like Dial but takes a packet size.
 // By default, the packet size is 512, see https://github.com/etsy/statsd/blob/master/docs/metric_types.md#multi-metric-packets for guidelines.
-func DialSize(addr string, size int) (*Client, error) {
-	conn, err := net.Dial("udp", addr)
-	if err != nil {
-		return nil, err
+func DialSize(addr string, size int, opts ...Option) (*Client, error) {
+	return New(addr, withOptions(opts, WithBufferSize(size))...)
+}
+
+// withOptions returns opts followed by more, without modifying the caller's slice.
+func withOptions(opts []Option, more ...Option) []Option {
+	return append(append([]Option(nil), opts...), more...)
+}
+
+func dialConn(network, addr string, timeout time.Duration) (net.Conn, error) {
+	if timeout > 0 {
+		return net.DialTimeout(network, addr, timeout)
 	}
-	return newClient(conn, size), nil
+	return net.Dial(network, addr)
 }
 
-func newClient(conn net.Conn, size int) *Client {
+func newClient(conn net.Conn, size int, opts []Option) (*Client, error) {
 	if size <= 0 {
 		size = defaultBufSize
 	}
-	return &Client{
-		conn: conn,
-		w:    conn,
+	c := &Client{core: newCore(conn, size)}
+	c.conn = conn
+	c.configure(opts)
+	switch conn.RemoteAddr().Network() {
+	case "tcp", "tcp4", "tcp6", "unix":
+		c.stream = true
+	}
+	if c.fallbackAddr != "" {
+		c.failover = newFailover(conn, c.fallbackAddr, c.timeout, func() time.Time { return c.now() })
+		c.w = c.failover
+	}
+	if _, ok := conn.(*net.UDPConn); ok && size > c.mtu {
+		if c.strictMTU {
+			conn.Close()
+			return nil, fmt.Errorf("statsd: packet size %d exceeds the safe UDP packet size %d", size, c.mtu)
+		}
+		c.logf("statsd: packet size %d exceeds the safe UDP packet size %d, packets may be fragmented and lost", size, c.mtu)
+	}
+	c.start()
+	return c, nil
+}
+
+func newCore(w io.Writer, size int) *core {
+	c := &core{w: w, size: size}
+	c.buf = bufio.NewWriterSize(sink{c}, size)
+	return c
+}
+
+// sink forwards the packets flushed by the buffer to the current writer,
+// which changes on reconnection, and counts the bytes written.
+type sink struct {
+	c *core
+}
+
+func (s sink) Write(p []byte) (int, error) {
+	if conn := s.c.deadliner(); s.c.writeTimeout > 0 && conn != nil {
+		deadline := time.Now().Add(s.c.writeTimeout)
+		if !s.c.ctxDeadline.IsZero() && s.c.ctxDeadline.Before(deadline) {
+			deadline = s.c.ctxDeadline
+		}
+		conn.SetWriteDeadline(deadline)
+	}
+	n, err := s.c.w.Write(p)
+	s.c.bytesWritten += uint64(n)
+	return n, err
+}
+
+// deadliner is the connection a write deadline is set on.
+type deadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// deadliner returns what write deadlines are set on: the failover, which applies
+// them to the endpoint in use, or the connection. It is nil for plain writers.
+func (c *core) deadliner() deadliner {
+	if c.failover != nil {
+		return c.failover
+	}
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn
+}
+
+// start starts the background work of a configured client.
+func (c *Client) start() {
+	c.FlushEvery(c.flushInterval)
+	if c.asyncSize > 0 {
+		c.async = newAsyncQueue(c.asyncSize)
+	}
+}
+
+func (c *Client) configure(opts []Option) {
+	c.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	c.apply(newConfig(opts))
+	c.prefix = c.config.prefix
+	if c.pushURL != "" {
+		c.pusher = newPusher(c.config)
+	}
+}
+
+// apply sets the configuration of the client and updates the state derived from it.
+func (c *Client) apply(cfg config) {
+	adaptiveTarget := c.adaptiveTarget
+	c.config = cfg
+	if c.adaptiveTarget != adaptiveTarget || c.sampler == nil {
+		c.sampler = nil
+		if c.adaptiveTarget > 0 {
+			c.sampler = newAdaptiveSampler(c.adaptiveTarget)
+		}
+	}
+	if c.strictRegistry && c.registry == nil {
+		c.registry = newRegistry()
+	}
+	c.tags = formatTags(c.defaultTags)
+	c.extractor.Store(cfg.tagExtractor)
+}
+
+// Reconfigure atomically applies opts to the running client: metrics sent
+// concurrently see either the previous configuration or the new one, never a mix.
+//
+// Every option can be changed at runtime except the ones fixed when the client
+// is created, WithNetwork, WithTimeout, WithBufferSize, WithFlushInterval, WithAsync,
+// WithMTU, WithStrictMTU, WithFallbackAddr, WithPushgateway, WithPrometheusType
+// and WithPrometheusBuckets. Reconfigure returns an error and leaves the client
+// untouched if opts try to change them.
+// Changing WithAdaptiveSampling resets the observed rates.
+// Only the prefix is specific to c, the other options also apply to the clients
+// created by WithPrefix.
+func (c *Client) Reconfigure(opts ...Option) error {
+	if c.nop {
+		return nil
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	cfg := c.config
+	cfg.prefix = c.prefix
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if !reflect.DeepEqual(cfg.static(), c.config.static()) {
+		return errors.New("statsd: option cannot be changed at runtime")
+	}
+	c.apply(cfg)
+	c.prefix = cfg.prefix
+	return nil
+}
+
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, args...)
+		return
 	}
+	log.Printf(format, args...)
+}
+
+// BufferSize returns the packet size the client has been configured with.
+func (c *Client) BufferSize() int {
+	return c.size
 }
 
 // Prefix adds a prefix to every stat string. The prefix is literal,
 // so if you want "foo.bar.baz" from "baz" you should set the prefix
 // to "foo.bar." not "foo.bar" as no delimiter is added for you.
 func (c *Client) Prefix(s string) {
+	c.m.Lock()
+	defer c.m.Unlock()
 	c.prefix = s
 }
 
+// WithPrefix returns a client sending its metrics with the prefix s instead of
+// the one of c, through the same connection and buffer. Metrics of both clients
+// are serialized in the same packets.
+//
+// The clients share everything but their prefix: closing one closes the other,
+// and Reconfigure options other than WithPrefix apply to both.
+func (c *Client) WithPrefix(s string) *Client {
+	return &Client{core: c.core, prefix: s}
+}
+
+// String describes the client, its remote address, prefix, default tags and packet size.
+func (c *Client) String() string {
+	c.m.Lock()
+	defer c.m.Unlock()
+	addr := "none"
+	if c.conn != nil {
+		addr = c.conn.RemoteAddr().String()
+	}
+	return fmt.Sprintf("statsd.Client{addr: %s, prefix: %q, tags: %q, size: %d}", addr, c.prefix, c.tags, c.size)
+}
+
 // Increment increments the counter for the given bucket.
 func (c *Client) Increment(stat string, count int, rate float64) error {
-	return c.send(stat, rate, "%d|c", count)
+	return c.IncrementTags(stat, count, rate, nil)
+}
+
+// IncrementTags acts like Increment but tags the metric, see SetTags for the rendering of tags.
+func (c *Client) IncrementTags(stat string, count int, rate float64, tags map[string]string) error {
+	return c.send(TypeCounter, stat, rate, tagList(tags), "%d", count)
 }
 
 // Incr increments the counter for the given bucket by 1 at a rate of 1.
@@ -98,6 +455,11 @@ func (c *Client) Decrement(stat string, count int, rate float64) error {
 	return c.Increment(stat, -count, rate)
 }
 
+// DecrementTags acts like Decrement but tags the metric.
+func (c *Client) DecrementTags(stat string, count int, rate float64, tags map[string]string) error {
+	return c.IncrementTags(stat, -count, rate, tags)
+}
+
 // Decr decrements the counter for the given bucket by 1 at a rate of 1.
 func (c *Client) Decr(stat string) error {
 	return c.Increment(stat, -1, 1)
@@ -108,24 +470,70 @@ func (c *Client) DecrBy(stat string, value int) error {
 	return c.Increment(stat, -value, 1)
 }
 
+// ResetCounter marks an intentional reset of the counter for the given bucket.
+// statsd servers already reset counters on every flush interval, so nothing is
+// sent to the counter itself: a companion "<stat>.reset" gauge is set to the
+// current unix time instead. As gauges keep their last value on the server,
+// dashboards detect a reset by a change of the companion gauge, telling it apart from a gap in the data.
+// The reset is never sampled, the name and registry checks apply to the counter itself.
+func (c *Client) ResetCounter(stat string) error {
+	return c.emit(true, counterReset, stat, 1, nil, "%d")
+}
+
 // Duration records time spent for the given bucket with time.Duration.
 func (c *Client) Duration(stat string, duration time.Duration, rate float64) error {
-	return c.send(stat, rate, "%d|ms", millisecond(duration))
+	return c.DurationTags(stat, duration, rate, nil)
+}
+
+// DurationTags acts like Duration but tags the metric.
+func (c *Client) DurationTags(stat string, duration time.Duration, rate float64, tags map[string]string) error {
+	return c.send(TypeTimer, stat, rate, tagList(tags), "%v", milliseconds(duration))
 }
 
 // DurationSince records time spent for the given bucket since `t`.
 func (c *Client) DurationSince(stat string, t time.Time) error {
-	return c.send(stat, 1, "%d|ms", millisecond(time.Since(t)))
+	return c.send(TypeTimer, stat, 1, nil, "%v", milliseconds(time.Since(t)))
 }
 
 // Timing records time spent for the given bucket in milliseconds.
 func (c *Client) Timing(stat string, delta int, rate float64) error {
-	return c.send(stat, rate, "%d|ms", delta)
+	return c.TimingTags(stat, delta, rate, nil)
+}
+
+// TimingTags acts like Timing but tags the metric.
+func (c *Client) TimingTags(stat string, delta int, rate float64, tags map[string]string) error {
+	return c.send(TypeTimer, stat, rate, tagList(tags), "%d", delta)
+}
+
+// TimingFloat records time spent for the given bucket in fractional milliseconds.
+func (c *Client) TimingFloat(stat string, delta float64, rate float64) error {
+	return c.TimingFloatTags(stat, delta, rate, nil)
+}
+
+// TimingFloatTags acts like TimingFloat but tags the metric.
+func (c *Client) TimingFloatTags(stat string, delta float64, rate float64, tags map[string]string) error {
+	return c.send(TypeTimer, stat, rate, tagList(tags), "%s", decimal(delta))
 }
 
-// Histogram is an alias of .Timing() until statsd implementations figure their shit out.
+// Histogram records a value in the histogram of the given bucket, sent with the "h" type.
+// Servers without native histograms can be given timers instead, see WithLegacyHistogram.
 func (c *Client) Histogram(stat string, value int, rate float64) error {
-	return c.send(stat, rate, "%d|ms", value)
+	return c.HistogramTags(stat, value, rate, nil)
+}
+
+// HistogramTags acts like Histogram but tags the metric.
+func (c *Client) HistogramTags(stat string, value int, rate float64, tags map[string]string) error {
+	return c.send(TypeHistogram, stat, rate, tagList(tags), "%d", value)
+}
+
+// HistogramFloat acts like Histogram but takes a float value.
+func (c *Client) HistogramFloat(stat string, value float64, rate float64) error {
+	return c.HistogramFloatTags(stat, value, rate, nil)
+}
+
+// HistogramFloatTags acts like HistogramFloat but tags the metric.
+func (c *Client) HistogramFloatTags(stat string, value float64, rate float64, tags map[string]string) error {
+	return c.send(TypeHistogram, stat, rate, tagList(tags), "%s", decimal(value))
 }
 
 // Time calculates time spent in given function and send it.
@@ -136,72 +544,597 @@ func (c *Client) Time(stat string, rate float64, f func()) error {
 }
 
 // Gauge records arbitrary values for the given bucket.
+// As a leading minus sign means a decrement to statsd, a negative value is sent
+// as a reset to zero followed by the value, in the same packet.
 func (c *Client) Gauge(stat string, value int, rate float64) error {
-	return c.send(stat, rate, "%d|g", value)
+	return c.GaugeTags(stat, value, rate, nil)
+}
+
+// GaugeTags acts like Gauge but tags the metric.
+func (c *Client) GaugeTags(stat string, value int, rate float64, tags map[string]string) error {
+	if value < 0 {
+		return c.send(TypeGauge, stat, rate, tagList(tags), "%v", negativeGauge{value})
+	}
+	return c.send(TypeGauge, stat, rate, tagList(tags), "%d", value)
+}
+
+// GaugeFloat records arbitrary fractional values for the given bucket.
+// Negative values are handled as in Gauge.
+func (c *Client) GaugeFloat(stat string, value float64, rate float64) error {
+	return c.GaugeFloatTags(stat, value, rate, nil)
+}
+
+// GaugeFloatTags acts like GaugeFloat but tags the metric.
+func (c *Client) GaugeFloatTags(stat string, value float64, rate float64, tags map[string]string) error {
+	if value < 0 {
+		return c.send(TypeGauge, stat, rate, tagList(tags), "%v", negativeGauge{decimal(value)})
+	}
+	return c.send(TypeGauge, stat, rate, tagList(tags), "%s", decimal(value))
 }
 
 // IncrementGauge increments the value of the gauge.
+// A negative value decrements the gauge instead.
 func (c *Client) IncrementGauge(stat string, value int, rate float64) error {
-	return c.send(stat, rate, "+%d|g", value)
+	return c.IncrementGaugeTags(stat, value, rate, nil)
+}
+
+// IncrementGaugeTags acts like IncrementGauge but tags the metric.
+func (c *Client) IncrementGaugeTags(stat string, value int, rate float64, tags map[string]string) error {
+	if value < 0 {
+		// Through uint64 so that the smallest int doesn't overflow once negated.
+		return c.send(TypeGauge, stat, rate, tagList(tags), "-%d", uint64(-value))
+	}
+	return c.send(TypeGauge, stat, rate, tagList(tags), "+%d", uint64(value))
 }
 
 // IncrementGaugeBy increments the value of the gauge.
 func (c *Client) IncrementGaugeBy(stat string, value int) error {
-	return c.send(stat, 1, "+%d|g", value)
+	return c.IncrementGauge(stat, value, 1)
 }
 
 // DecrementGauge decrements the value of the gauge.
+// A negative value increments the gauge instead.
 func (c *Client) DecrementGauge(stat string, value int, rate float64) error {
-	return c.send(stat, rate, "-%d|g", value)
+	return c.DecrementGaugeTags(stat, value, rate, nil)
+}
+
+// DecrementGaugeTags acts like DecrementGauge but tags the metric.
+func (c *Client) DecrementGaugeTags(stat string, value int, rate float64, tags map[string]string) error {
+	if value < 0 {
+		return c.send(TypeGauge, stat, rate, tagList(tags), "+%d", uint64(-value))
+	}
+	return c.send(TypeGauge, stat, rate, tagList(tags), "-%d", uint64(value))
 }
 
 // DecrementGaugeBy decrements the value of the gauge.
 func (c *Client) DecrementGaugeBy(stat string, value int) error {
-	return c.send(stat, 1, "-%d|g", value)
+	return c.DecrementGauge(stat, value, 1)
+}
+
+// IncrementGaugeFloat increments the value of the gauge by a fractional amount.
+// A negative value decrements the gauge instead.
+func (c *Client) IncrementGaugeFloat(stat string, value float64, rate float64) error {
+	return c.IncrementGaugeFloatTags(stat, value, rate, nil)
+}
+
+// IncrementGaugeFloatTags acts like IncrementGaugeFloat but tags the metric.
+func (c *Client) IncrementGaugeFloatTags(stat string, value float64, rate float64, tags map[string]string) error {
+	// Signbit also catches negative zero, which would be sent as "+-0".
+	if math.Signbit(value) {
+		return c.send(TypeGauge, stat, rate, tagList(tags), "-%s", decimal(-value))
+	}
+	return c.send(TypeGauge, stat, rate, tagList(tags), "+%s", decimal(value))
+}
+
+// DecrementGaugeFloat decrements the value of the gauge by a fractional amount.
+// A negative value increments the gauge instead.
+func (c *Client) DecrementGaugeFloat(stat string, value float64, rate float64) error {
+	return c.DecrementGaugeFloatTags(stat, value, rate, nil)
+}
+
+// DecrementGaugeFloatTags acts like DecrementGaugeFloat but tags the metric.
+func (c *Client) DecrementGaugeFloatTags(stat string, value float64, rate float64, tags map[string]string) error {
+	if math.Signbit(value) {
+		return c.send(TypeGauge, stat, rate, tagList(tags), "+%s", decimal(-value))
+	}
+	return c.send(TypeGauge, stat, rate, tagList(tags), "-%s", decimal(value))
 }
 
 // Unique records unique occurences of events.
 func (c *Client) Unique(stat string, value int, rate float64) error {
-	return c.send(stat, rate, "%d|s", value)
+	return c.UniqueTags(stat, value, rate, nil)
+}
+
+// UniqueTags acts like Unique but tags the metric.
+func (c *Client) UniqueTags(stat string, value int, rate float64, tags map[string]string) error {
+	return c.send(TypeSet, stat, rate, tagList(tags), "%d", value)
+}
+
+// Distribution records a value in a distribution, which DataDog aggregates across
+// all the hosts sending it rather than per host, to compute global percentiles.
+func (c *Client) Distribution(stat string, value float64, rate float64) error {
+	return c.DistributionTags(stat, value, rate, nil)
+}
+
+// DistributionTags acts like Distribution but tags the metric.
+func (c *Client) DistributionTags(stat string, value float64, rate float64, tags map[string]string) error {
+	return c.send(TypeDistribution, stat, rate, tagList(tags), "%s", decimal(value))
+}
+
+// UniqueString acts like Unique for string values, such as user IDs, sent verbatim.
+// Values containing a newline are rejected as they would break the packet framing.
+func (c *Client) UniqueString(stat string, value string, rate float64) error {
+	return c.UniqueStringTags(stat, value, rate, nil)
+}
+
+// UniqueStringTags acts like UniqueString but tags the metric.
+func (c *Client) UniqueStringTags(stat string, value string, rate float64, tags map[string]string) error {
+	if !c.nop && strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("statsd: set value %q contains a newline", value)
+	}
+	return c.send(TypeSet, stat, rate, tagList(tags), "%s", value)
 }
 
 // Annotate sends an annotation.
 func (c *Client) Annotate(name string, value string, args ...interface{}) error {
-	return c.send(name, 1, "%s|a", fmt.Sprintf(value, args...))
+	return c.send(TypeAnnotation, name, 1, nil, "%s", fmt.Sprintf(value, args...))
 }
 
-// Flush does nothing at the moment, pending new buffer implementation.
+// Flush sends any buffered metrics to the server, along with the metrics aggregated by the client.
+// When a pushgateway is configured, the metrics are pushed to it as well.
+// It returns ErrClosed once the client has been closed.
 func (c *Client) Flush() error {
+	_, err := c.flushAll(context.Background(), false)
+	return err
+}
+
+// FlushN acts like Flush but also returns the number of bytes written to the server,
+// zero if the buffer was empty.
+func (c *Client) FlushN() (n int, err error) {
+	return c.flushAll(context.Background(), false)
+}
+
+// flushAll implements the flush methods, closing is set for the final flush of a client being closed.
+// It returns the number of bytes written, including the packets flushed while collecting
+// the aggregated metrics.
+func (c *Client) flushAll(ctx context.Context, closing bool) (int, error) {
+	if c.nop {
+		return 0, nil
+	}
+	if c.async != nil {
+		if err := c.async.drain(ctx); err != nil {
+			return 0, err
+		}
+	}
+	c.sampleGauges("")
+	if c.closed && !closing {
+		c.m.Unlock()
+		return 0, ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		c.m.Unlock()
+		return 0, err
+	}
+	written := c.bytesWritten
+	release := c.watchContext(ctx)
+	err := c.collect()
+	if err == nil {
+		err = c.flush()
+	}
+	release()
+	if err != nil {
+		err = contextError(ctx, err)
+	}
+	n := int(c.bytesWritten - written)
+	var body []byte
+	if c.pusher != nil {
+		body = c.pusher.render()
+	}
+	c.m.Unlock()
+
+	if err != nil {
+		return n, err
+	}
+	if body != nil {
+		return n, c.pusher.push(ctx, body)
+	}
+	return n, nil
+}
+
+// collect buffers the metrics aggregated client side, the lock must be held.
+func (c *Client) collect() error {
+	for _, col := range c.collectors {
+		if err := col.collect(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// Close closes the connection.
-func (c *Client) Close() error {
-	if err := c.Flush(); err != nil {
+func (c *Client) flush() error {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if err := c.buf.Flush(); err != nil {
+		// The writer keeps failing once an error occurred, drop the packet to
+		// be able to send the next ones.
+		c.buf.Reset(sink{c.core})
+		c.flushErrors++
+		c.reconnect()
 		return err
 	}
+	c.dialDelay = 0
+	return nil
+}
+
+// reconnect dials the server again after a write error, so that a restarted
+// server or a transient network failure doesn't break the client for good.
+// Attempts are spaced with an exponential backoff. The lock must be held.
+func (c *Client) reconnect() {
+	if c.addr == "" {
+		return
+	}
+	now := c.now()
+	if now.Before(c.nextDial) {
+		return
+	}
+	c.dialDelay *= 2
+	if c.dialDelay < minReconnectDelay {
+		c.dialDelay = minReconnectDelay
+	}
+	if c.dialDelay > maxReconnectDelay {
+		c.dialDelay = maxReconnectDelay
+	}
+	c.nextDial = now.Add(c.dialDelay)
+
+	timeout := c.timeout
+	if timeout <= 0 {
+		timeout = reconnectTimeout
+	}
+	conn, err := dialConn(c.network, c.addr, timeout)
+	if err != nil {
+		debug("reconnect to %s failed: %s", c.addr, err)
+		return
+	}
+	c.conn.Close()
+	c.conn = conn
+	if c.failover != nil {
+		c.failover.setPrimary(conn)
+	} else {
+		c.w = conn
+	}
+}
+
+// flushAged is called by the max age timer armed for the given buffer generation
+// once the oldest buffered metric has expired.
+func (c *Client) flushAged(generation uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.timer == nil || c.generation != generation {
+		// The buffer has been flushed since the timer was armed.
+		return
+	}
+	if err := c.flush(); err != nil {
+		debug("flush failed: %s", err)
+	}
+}
+
+// FlushEvery starts flushing the client every d in the background, until the returned
+// function is called or the client is closed. A zero or negative d does nothing.
+func (c *Client) FlushEvery(d time.Duration) (stop func()) {
+	if d <= 0 || c.nop {
+		return func() {}
+	}
+	done := make(chan struct{})
+	var once sync.Once
+	stop = func() {
+		once.Do(func() { close(done) })
+	}
+
+	c.m.Lock()
+	if c.closed {
+		c.m.Unlock()
+		return func() {}
+	}
+	c.stops = append(c.stops, stop)
+	// Added under the lock, so that a concurrent Close waits for this goroutine too.
+	c.tickers.Add(1)
+	c.m.Unlock()
+
+	go func() {
+		defer c.tickers.Done()
+		t := time.NewTicker(d)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := c.Flush(); err != nil {
+					debug("flush failed: %s", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return stop
+}
+
+// stopTickers stops the background flushes and waits for them to return.
+func (c *Client) stopTickers() {
+	c.m.Lock()
+	stops := c.stops
+	c.stops = nil
+	c.m.Unlock()
+	for _, stop := range stops {
+		stop()
+	}
+	c.tickers.Wait()
+}
+
+// Close flushes pending metrics and closes the connection, see Shutdown.
+// Closing a client more than once returns ErrClosed.
+func (c *Client) Close() error {
+	return c.Shutdown(context.Background())
+}
+
+func (c *Client) closeConn() error {
+	if c.failover != nil {
+		c.failover.Close()
+	}
+	if c.conn == nil {
+		return nil
+	}
 	return c.conn.Close()
 }
 
-func (c *Client) send(stat string, rate float64, format string, args ...interface{}) error {
-	if c.prefix != "" {
-		stat = c.prefix + stat
+// Shutdown stops accepting new metrics, flushes pending data and closes the connection.
+// Metrics sent once Shutdown has begun are rejected with ErrClosed.
+// If ctx is done before the teardown completes, Shutdown returns ctx.Err().
+func (c *Client) Shutdown(ctx context.Context) error {
+	if c.nop {
+		return nil
+	}
+	c.m.Lock()
+	if c.closed {
+		c.m.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	c.m.Unlock()
+	if c.async != nil {
+		// The queue is stopped right away, so that metrics sent from now on are
+		// rejected, while the worker drains it below.
+		c.async.stop()
 	}
 
-	if rate < 1 {
-		if rand.Float64() < rate {
-			format = fmt.Sprintf("%s|@%g", format, rate)
-		} else {
-			return nil
+	done := make(chan error, 1)
+	go func() {
+		c.stopTickers()
+		if c.async != nil {
+			c.async.wait()
 		}
+		_, err := c.flushAll(ctx, true)
+		if cerr := c.closeConn(); err == nil {
+			err = cerr
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	format = fmt.Sprintf("%s:%s", stat, format)
-	debug(format, args...)
+func (c *Client) send(typ MetricType, stat string, rate float64, tags []string, format string, args ...interface{}) error {
+	return c.emit(false, typ, stat, rate, tags, format, args...)
+}
+
+// emit samples and records a metric, unless force is set in which case it is always recorded at full rate.
+// Asynchronous clients queue it, it is then sampled and recorded by their worker.
+func (c *Client) emit(force bool, typ MetricType, stat string, rate float64, tags []string, format string, args ...interface{}) error {
+	if c.nop {
+		return nil
+	}
+	if c.async != nil {
+		return c.async.enqueue(queuedMetric{c: c, force: force, typ: typ, stat: stat, rate: rate, tags: tags, format: format, args: args})
+	}
 
 	c.m.Lock()
 	defer c.m.Unlock()
 
-	_, err := fmt.Fprintf(c.w, format, args...)
+	if c.closed {
+		return ErrClosed
+	}
+	return c.emitLocked(force, typ, stat, rate, tags, format, args...)
+}
+
+// emitLocked is emit with the lock held.
+func (c *Client) emitLocked(force bool, typ MetricType, stat string, rate float64, tags []string, format string, args ...interface{}) error {
+	if c.specs {
+		spec, err := ParseSpec(stat)
+		if err != nil {
+			return err
+		}
+		stat = spec.Name
+		if spec.Rate > 0 {
+			rate = spec.Rate
+		}
+		tags = append(spec.Tags, tags...)
+	}
+
+	if typ == TypeHistogram && c.legacyHistogram {
+		typ = TypeTimer
+	}
+
+	if c.strictNames {
+		if err := validateStat(c.prefix + stat); err != nil {
+			return err
+		}
+	}
+
+	if typ == counterReset {
+		if err := c.checkRegistered(TypeCounter, stat); err != nil {
+			return err
+		}
+		return c.record(TypeGauge, stat+".reset", 1, tags, format, timestamp(c.now().Unix()))
+	}
+	if err := c.checkRegistered(typ, stat); err != nil {
+		return err
+	}
+
+	if force {
+		rate = 1
+	} else {
+		if c.sampler != nil {
+			rate = c.sampler.rate(c.prefix+stat, c.now())
+		}
+		if rate < 1 && c.rand.Float64() >= rate {
+			if c.batch != nil {
+				c.batch.sampled++
+			} else {
+				c.sampled++
+			}
+			return nil
+		}
+	}
+	return c.record(typ, stat, rate, tags, format, args...)
+}
+
+// record formats and buffers a metric that made it through sampling, the lock must be held.
+func (c *Client) record(typ MetricType, stat string, rate float64, tags []string, format string, args ...interface{}) error {
+	reset := false
+	if len(args) > 0 {
+		v := args[0]
+		if g, ok := v.(negativeGauge); ok {
+			v, reset = g.value, true
+		}
+		if d, ok := v.(milliseconds); ok {
+			if c.preciseDurations {
+				v = decimal(float64(d) / float64(time.Millisecond))
+			} else {
+				v = millisecond(time.Duration(d))
+			}
+		}
+		if factor, ok := c.scale[typ]; ok {
+			v = scaleValue(v, factor)
+		}
+		args = append([]interface{}{v}, args[1:]...)
+	}
+
+	if c.prefix != "" {
+		stat = c.prefix + stat
+	}
+
+	// Only the value is formatted, the bucket name and tags are never interpreted as format strings.
+	values := []string{fmt.Sprintf(format, args...)}
+	if reset && strings.HasPrefix(values[0], "-") {
+		// A leading sign makes a gauge value a delta, the gauge has to be
+		// reset to zero before it can be set to a negative value.
+		values = []string{"0", values[0]}
+	}
+
+	// Sequence numbers are only consumed by the lines making it into the buffer,
+	// a rejected metric must not show up as a gap.
+	seq := c.seq
+	lines := make([]string, len(values))
+	for i, value := range values {
+		line := c.formatLine(typ, stat, rate, tags, value)
+		debug("%s", line)
+		if c.strict {
+			if err := parseLine(line); err != nil {
+				c.seq = seq
+				return err
+			}
+		}
+		lines[i] = line
+	}
+	if c.batch != nil {
+		c.batch.lines = append(c.batch.lines, lines...)
+		c.observe(typ, stat, rate, values)
+		return nil
+	}
+	// Lines are written at once so that they end up in the same packet.
+	buffered, err := c.write(strings.Join(lines, "\n"))
+	if !buffered {
+		c.seq = seq
+		return err
+	}
+	c.observe(typ, stat, rate, values)
 	return err
 }
+
+// observe records the values of a buffered metric for the Prometheus push, or defers
+// it until the Batch being sent is buffered, see effect. The lock must be held.
+func (c *Client) observe(typ MetricType, stat string, rate float64, values []string) {
+	if c.pusher == nil {
+		return
+	}
+	c.effect(func() {
+		for _, value := range values {
+			c.pusher.observe(typ, stat, rate, value)
+		}
+	})
+}
+
+// formatLine assembles a metric line, the lock must be held.
+func (c *Client) formatLine(typ MetricType, stat string, rate float64, tags []string, value string) string {
+	line := stat + ":" + value + "|" + string(typ)
+	if rate < 1 && !c.omitRate[typ] {
+		line += "|@" + strconv.FormatFloat(rate, 'g', -1, 64)
+	}
+	if c.sequence {
+		c.seq++
+		tags = append(tags[:len(tags):len(tags)], "seq:"+strconv.FormatUint(c.seq, 10))
+	}
+	if tags := c.joinTags(tags); tags != "" {
+		line += "|#" + tags
+	}
+	return line
+}
+
+// write buffers a single metric line, flushing according to the flush policy:
+// the buffer is flushed before the line if it would not fit in the packet size,
+// and after it when the buffer reaches the high-water mark set by WithMaxBytes.
+// Independently, a buffer older than WithMaxAge is flushed by a timer.
+// Lines larger than the packet size are rejected as the packet would likely be dropped.
+// buffered reports whether the line made it into the buffer, even if flushing it failed.
+func (c *Client) write(line string) (buffered bool, err error) {
+	if !c.stream && len(line) > c.size {
+		return false, fmt.Errorf("statsd: metric of %d bytes exceeds the packet size %d: %.32q...", len(line), c.size, line)
+	}
+	if c.buf.Buffered() > 0 && c.buf.Buffered()+len(line)+1 > c.size {
+		if err := c.flush(); err != nil {
+			return false, err
+		}
+	}
+
+	if c.buf.Buffered() > 0 {
+		if !c.stream {
+			c.buf.WriteByte('\n')
+		}
+	} else if c.maxAge > 0 {
+		c.generation++
+		generation := c.generation
+		c.timer = time.AfterFunc(c.maxAge, func() { c.flushAged(generation) })
+	}
+
+	if c.stream {
+		// Streams have no packet boundaries, every metric is terminated instead.
+		line += "\n"
+	}
+	if _, err := c.buf.WriteString(line); err != nil {
+		// The line may have been partially written, don't leave it in front of the next metrics.
+		c.buf.Reset(sink{c.core})
+		c.flushErrors++
+		return false, err
+	}
+
+	if c.maxBytes > 0 && c.buf.Buffered() >= c.maxBytes {
+		return true, c.flush()
+	}
+	return true, nil
+}
@@ -2,6 +2,16 @@ package statsd
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -12,6 +22,25 @@ func assert(t *testing.T, value, control string) {
 	}
 }
 
+// packetWriter records every write as a separate packet.
+type packetWriter struct {
+	m       sync.Mutex
+	packets []string
+}
+
+func (w *packetWriter) Write(p []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	w.packets = append(w.packets, string(p))
+	return len(p), nil
+}
+
+func (w *packetWriter) Packets() []string {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return append([]string(nil), w.packets...)
+}
+
 func TestPrefix(t *testing.T) {
 	buf := new(bytes.Buffer)
 	c := NewClient(buf)
@@ -24,6 +53,96 @@ func TestPrefix(t *testing.T) {
 	assert(t, buf.String(), "foo.bar.baz.incr:1|c")
 }
 
+func TestWithPrefix(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w, WithPrefix("app."))
+	api := c.WithPrefix("api.")
+	worker := c.WithPrefix("worker.")
+
+	var wg sync.WaitGroup
+	for _, client := range []*Client{c, api, worker} {
+		wg.Add(1)
+		go func(client *Client) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				client.Incr("incr")
+			}
+		}(client)
+	}
+	wg.Wait()
+	api.Prefix("users.")
+	api.Incr("incr")
+	c.Flush()
+
+	counts := make(map[string]int)
+	for _, packet := range w.Packets() {
+		for _, line := range strings.Split(packet, "\n") {
+			counts[line]++
+		}
+	}
+	for line, want := range map[string]int{"app.incr:1|c": 100, "api.incr:1|c": 100, "worker.incr:1|c": 100, "users.incr:1|c": 1} {
+		if counts[line] != want {
+			t.Errorf("want %d %q, got %d", want, line, counts[line])
+		}
+	}
+	assert(t, c.String(), `statsd.Client{addr: none, prefix: "app.", tags: "", size: 512}`)
+}
+
+func TestBufferSize(t *testing.T) {
+	c := NewClient(new(bytes.Buffer))
+	if size := c.BufferSize(); size != defaultBufSize {
+		t.Errorf("incorrect size, want %d, got %d", defaultBufSize, size)
+	}
+}
+
+func TestString(t *testing.T) {
+	c, err := DialSize("127.0.0.1:8125", 1024, WithTags(map[string]string{"env": "prod"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Prefix("foo.")
+	assert(t, fmt.Sprintf("%v", c), `statsd.Client{addr: 127.0.0.1:8125, prefix: "foo.", tags: "env:prod", size: 1024}`)
+}
+
+func TestMTU(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c, err := DialSize("127.0.0.1:8125", 9000, WithLogger(log.New(buf, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	assert(t, buf.String(), "statsd: packet size 9000 exceeds the safe UDP packet size 1432, packets may be fragmented and lost\n")
+
+	_, err = DialSize("127.0.0.1:8125", 9000, WithStrictMTU())
+	if err == nil {
+		t.Error("expected an error for a packet size larger than the MTU")
+	}
+
+	c, err = DialSize("127.0.0.1:8125", 9000, WithMTU(9000), WithStrictMTU())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+}
+
+func TestFormatDirectives(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	c.Prefix("%d.")
+	c.SetTags(map[string]string{"path": "/%s"})
+	err := c.Increment("req.%s.count", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.TimingTags("req.100%.timing", 350, 1, map[string]string{"q": "%v"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "%d.req.%s.count:1|c|#path:/%s\n%d.req.100%.timing:350|ms|#path:/%s,q:%v")
+}
+
 func TestIncrement(t *testing.T) {
 	buf := new(bytes.Buffer)
 	c := NewClient(buf)
@@ -68,6 +187,39 @@ func TestDecr(t *testing.T) {
 	assert(t, buf.String(), "decr:-1|c")
 }
 
+func TestResetCounter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithClock(func() time.Time {
+		return time.Unix(1400000000, 0)
+	}))
+	err := c.ResetCounter("incr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "incr.reset:1400000000|g")
+}
+
+func TestResetCounterChecks(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithStrictRegistry(), WithStrictNames(), WithClock(func() time.Time {
+		return time.Unix(1400000000, 0)
+	}))
+	c.RegisterMetric("requests", TypeCounter)
+	c.RegisterMetric("workers", TypeGauge)
+	if err := c.ResetCounter("typo"); err == nil {
+		t.Error("expected an error for an unregistered counter")
+	}
+	if err := c.ResetCounter("workers"); err == nil {
+		t.Error("expected an error for a metric that isn't a counter")
+	}
+	if err := c.ResetCounter("requests"); err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "requests.reset:1400000000|g")
+}
+
 func TestDuration(t *testing.T) {
 	buf := new(bytes.Buffer)
 	c := NewClient(buf)
@@ -79,9 +231,42 @@ func TestDuration(t *testing.T) {
 	assert(t, buf.String(), "timing:123|ms")
 }
 
+func TestPreciseDuration(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithPreciseDurations())
+	err := c.Duration("timing", 1500*time.Microsecond, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "timing:1.5|ms")
+}
+
+func TestTimingFloat(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	err := c.TimingFloat("timing", 12.5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "timing:12.5|ms")
+}
+
+func TestGaugeFloat(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	c.GaugeFloat("ratio", 0.75, 1)
+	c.GaugeFloat("small", 0.0000125, 1)
+	c.GaugeFloat("large", 123456789.5, 1)
+	c.Flush()
+	assert(t, buf.String(), "ratio:0.75|g\nsmall:0.0000125|g\nlarge:123456789.5|g")
+}
+
 func TestIncrementRate(t *testing.T) {
 	buf := new(bytes.Buffer)
 	c := NewClient(buf)
+	c.SetRandSource(&floatSource{values: []float64{0}})
 	err := c.Increment("incr", 1, 0.99)
 	if err != nil {
 		t.Fatal(err)
@@ -93,6 +278,7 @@ func TestIncrementRate(t *testing.T) {
 func TestPreciseRate(t *testing.T) {
 	buf := new(bytes.Buffer)
 	c := NewClient(buf)
+	c.SetRandSource(&floatSource{values: []float64{0}})
 	// The real use case here is rates like 0.0001.
 	err := c.Increment("incr", 1, 0.99901)
 	if err != nil {
@@ -102,6 +288,22 @@ func TestPreciseRate(t *testing.T) {
 	assert(t, buf.String(), "incr:1|c|@0.99901")
 }
 
+func TestWithoutSampleRate(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithoutSampleRate(TypeGauge))
+	c.SetRandSource(&floatSource{values: []float64{0}})
+	err := c.Gauge("gauge", 300, 0.99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Increment("incr", 1, 0.99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "gauge:300|g\nincr:1|c|@0.99")
+}
+
 func TestRate(t *testing.T) {
 	buf := new(bytes.Buffer)
 	c := NewClient(buf)
@@ -124,6 +326,35 @@ func TestGauge(t *testing.T) {
 	assert(t, buf.String(), "gauge:300|g")
 }
 
+func TestNegativeGauge(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	err := c.Gauge("gauge", -5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.GaugeFloatTags("ratio", -0.5, 1, map[string]string{"env": "production"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "gauge:0|g\ngauge:-5|g\nratio:0|g|#env:production\nratio:-0.5|g|#env:production")
+}
+
+func TestNegativeGaugePacket(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w)
+	stat := strings.Repeat("a", 250)
+	c.Gauge(stat, 1, 1)
+	c.Gauge(stat, -1, 1)
+	c.Flush()
+	packets := w.Packets()
+	if len(packets) != 2 {
+		t.Fatalf("incorrect number of packets, want 2, got %d", len(packets))
+	}
+	assert(t, packets[1], stat+":0|g\n"+stat+":-1|g")
+}
+
 func TestIncrementGauge(t *testing.T) {
 	buf := new(bytes.Buffer)
 	c := NewClient(buf)
@@ -146,6 +377,64 @@ func TestDecrementGauge(t *testing.T) {
 	assert(t, buf.String(), "gauge:-4|g")
 }
 
+func TestNegativeIncrementGauge(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	err := c.IncrementGauge("gauge", -4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "gauge:-4|g")
+}
+
+func TestNegativeDecrementGauge(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	err := c.DecrementGauge("gauge", -10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "gauge:+10|g")
+}
+
+func TestIncrementGaugeFloat(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	err := c.IncrementGaugeFloat("gauge", 0.25, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "gauge:+0.25|g")
+}
+
+func TestDecrementGaugeFloat(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	err := c.DecrementGaugeFloat("gauge", -1.5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "gauge:+1.5|g")
+}
+
+func TestGaugeDeltaSigns(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	negativeZero := math.Copysign(0, -1)
+	c.IncrementGauge("gauge", math.MinInt64, 1)
+	c.DecrementGauge("gauge", math.MinInt64, 1)
+	c.IncrementGaugeFloat("gauge", negativeZero, 1)
+	c.DecrementGaugeFloat("gauge", negativeZero, 1)
+	c.GaugeFloat("gauge", negativeZero, 1)
+	c.Flush()
+	assert(t, buf.String(), "gauge:-9223372036854775808|g\ngauge:+9223372036854775808|g\n"+
+		"gauge:-0|g\ngauge:+0|g\ngauge:0|g")
+}
+
 func TestUnique(t *testing.T) {
 	buf := new(bytes.Buffer)
 	c := NewClient(buf)
@@ -157,6 +446,51 @@ func TestUnique(t *testing.T) {
 	assert(t, buf.String(), "unique:765|s")
 }
 
+func TestHistogram(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	c.SetRandSource(&floatSource{values: []float64{0}})
+	c.Histogram("histogram", 42, 1)
+	c.HistogramFloat("histogram", 0.5, 0.1)
+	c.HistogramTags("histogram", 1, 1, map[string]string{"env": "production"})
+	c.Flush()
+	assert(t, buf.String(), "histogram:42|h\nhistogram:0.5|h|@0.1\nhistogram:1|h|#env:production")
+}
+
+func TestLegacyHistogram(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithLegacyHistogram())
+	c.Histogram("histogram", 42, 1)
+	c.HistogramFloat("histogram", 0.5, 1)
+	c.Flush()
+	assert(t, buf.String(), "histogram:42|ms\nhistogram:0.5|ms")
+}
+
+func TestDistribution(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	c.SetRandSource(&floatSource{values: []float64{0}})
+	c.Distribution("distribution", 12.5, 1)
+	c.Distribution("distribution", 3, 0.5)
+	c.DistributionTags("distribution", 0.25, 1, map[string]string{"env": "production"})
+	c.Flush()
+	assert(t, buf.String(), "distribution:12.5|d\ndistribution:3|d|@0.5\ndistribution:0.25|d|#env:production")
+}
+
+func TestUniqueString(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	err := c.UniqueString("unique", "user-%d", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UniqueString("unique", "user\nincr:1|c", 1); err == nil {
+		t.Error("expected an error for a value containing a newline")
+	}
+	c.Flush()
+	assert(t, buf.String(), "unique:user-%d|s")
+}
+
 var millisecondTests = []struct {
 	duration time.Duration
 	control  int
@@ -195,6 +529,28 @@ func TestTiming(t *testing.T) {
 	assert(t, buf.String(), "timing:350|ms")
 }
 
+func TestScale(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithScale(TypeTimer, 0.001), WithScale(TypeGauge, 0.5), WithScale(TypeSet, 2))
+	c.Timing("timing", 1500, 1)
+	c.Timing("timing", 1499, 1)
+	c.IncrementGaugeFloat("gauge", 0.5, 1)
+	c.Unique("unique", 765, 1)
+	c.Flush()
+	assert(t, buf.String(), "timing:2|ms\ntiming:1|ms\ngauge:+0.25|g\nunique:765|s")
+}
+
+func TestScaleTimestamps(t *testing.T) {
+	buf := new(bytes.Buffer)
+	now := time.Unix(1700000000, 0)
+	c := NewClient(buf, WithScale(TypeGauge, 0.001), WithClock(func() time.Time { return now }))
+	c.Heartbeat("alive")
+	c.ResetCounter("requests")
+	c.Gauge("gauge", 3000, 1)
+	c.Flush()
+	assert(t, buf.String(), "requests.reset:1700000000|g\ngauge:3|g\nalive:1700000000|g")
+}
+
 func TestTime(t *testing.T) {
 	buf := new(bytes.Buffer)
 	c := NewClient(buf)
@@ -203,3 +559,483 @@ func TestTime(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestShutdown(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	err := c.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Incr("incr"); err != ErrClosed {
+		t.Errorf("incorrect error, want %v, got %v", ErrClosed, err)
+	}
+	if err := c.Shutdown(context.Background()); err != ErrClosed {
+		t.Errorf("incorrect error, want %v, got %v", ErrClosed, err)
+	}
+	assert(t, buf.String(), "")
+}
+
+func TestShutdownAsync(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w, WithAsync(1000))
+	for i := 0; i < 100; i++ {
+		c.Incr("incr")
+	}
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Incr("incr"); err != ErrClosed {
+		t.Errorf("incorrect error, want %v, got %v", ErrClosed, err)
+	}
+	lines := strings.Split(strings.Join(w.Packets(), "\n"), "\n")
+	if len(lines) != 100 {
+		t.Errorf("expected the queued metrics to be sent, got %d of them", len(lines))
+	}
+}
+
+// blockingWriter blocks the writes until release is closed.
+type blockingWriter struct {
+	packetWriter
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return w.packetWriter.Write(p)
+}
+
+func TestShutdownContext(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	c := NewClient(w, WithAsync(10))
+	c.Incr("incr")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("incorrect error, want %v, got %v", context.DeadlineExceeded, err)
+	}
+	if err := c.Incr("incr"); err != ErrClosed {
+		t.Errorf("incorrect error, want %v, got %v", ErrClosed, err)
+	}
+
+	close(w.release)
+	deadline := time.Now().Add(time.Second)
+	for len(w.Packets()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert(t, strings.Join(w.Packets(), ""), "incr:1|c")
+}
+
+func TestSequenceTracking(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithSequenceTracking())
+	for i := 0; i < 2; i++ {
+		err := c.Incr("incr")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Flush()
+	assert(t, buf.String(), "incr:1|c|#seq:1\nincr:1|c|#seq:2")
+}
+
+func TestSequenceTrackingRejected(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithSequenceTracking(), WithStrictValidation())
+	c.Incr("incr")
+	if err := c.Increment(strings.Repeat("a", defaultBufSize), 1, 1); err == nil {
+		t.Error("expected an error for an oversized metric")
+	}
+	if err := c.Gauge("gauge|c", 1, 1); err == nil {
+		t.Error("expected an error for an invalid metric")
+	}
+	b := c.Batch()
+	b.Incr(strings.Repeat("b", defaultBufSize))
+	if err := b.Send(); err == nil {
+		t.Error("expected an error for an oversized batch")
+	}
+	c.Incr("incr")
+	c.Flush()
+	assert(t, buf.String(), "incr:1|c|#seq:1\nincr:1|c|#seq:2")
+}
+
+// errorWriter fails every write while err is set.
+type errorWriter struct {
+	err error
+	buf bytes.Buffer
+}
+
+func (w *errorWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.buf.Write(p)
+}
+
+func TestFlushError(t *testing.T) {
+	w := &errorWriter{err: errors.New("write failed")}
+	c := NewClient(w)
+	c.Incr("incr")
+	if err := c.Flush(); err != w.err {
+		t.Fatalf("incorrect error, want %v, got %v", w.err, err)
+	}
+	w.err = nil
+	c.Decr("decr")
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, w.buf.String(), "decr:-1|c")
+}
+
+func TestFlushN(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	if n, err := c.FlushN(); n != 0 || err != nil {
+		t.Errorf("expected nothing flushed, got %d, %v", n, err)
+	}
+	c.Incr("incr")
+	c.Incr("incr")
+	n, err := c.FlushN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len("incr:1|c\nincr:1|c") {
+		t.Errorf("want %d bytes flushed, got %d", len("incr:1|c\nincr:1|c"), n)
+	}
+}
+
+func TestLineTooLarge(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w)
+	c.Incr("incr")
+	if err := c.Incr(strings.Repeat("a", defaultBufSize)); err == nil {
+		t.Error("expected an error for a metric larger than the packet size")
+	}
+	c.Flush()
+	packets := w.Packets()
+	if len(packets) != 1 {
+		t.Fatalf("expected a single packet, got %d", len(packets))
+	}
+	assert(t, packets[0], "incr:1|c")
+}
+
+func TestBufferFullError(t *testing.T) {
+	w := &errorWriter{err: errors.New("write failed")}
+	c := NewClient(w)
+	stat := strings.Repeat("a", 100)
+	var err error
+	for i := 0; i < 5 && err == nil; i++ {
+		err = c.Incr(stat)
+	}
+	if err != w.err {
+		t.Fatalf("incorrect error, want %v, got %v", w.err, err)
+	}
+	w.err = nil
+	c.Incr("incr")
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, w.buf.String(), "incr:1|c")
+}
+
+func TestBuffering(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	c.Incr("incr")
+	c.Decr("decr")
+	assert(t, buf.String(), "")
+	c.Flush()
+	assert(t, buf.String(), "incr:1|c\ndecr:-1|c")
+}
+
+func TestBufferFull(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w)
+	stat := strings.Repeat("a", 100)
+	for i := 0; i < 6; i++ {
+		c.Incr(stat)
+	}
+	c.Flush()
+	packets := w.Packets()
+	if len(packets) != 2 {
+		t.Fatalf("incorrect number of packets, want 2, got %d", len(packets))
+	}
+	line := stat + ":1|c"
+	assert(t, packets[0], strings.Repeat(line+"\n", 3)+line)
+	assert(t, packets[1], line+"\n"+line)
+}
+
+func TestMaxBytes(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w, WithMaxBytes(10))
+	c.Incr("incr")
+	if packets := w.Packets(); len(packets) != 0 {
+		t.Fatalf("incorrect number of packets, want 0, got %d", len(packets))
+	}
+	c.Incr("incr")
+	packets := w.Packets()
+	if len(packets) != 1 {
+		t.Fatalf("incorrect number of packets, want 1, got %d", len(packets))
+	}
+	assert(t, packets[0], "incr:1|c\nincr:1|c")
+}
+
+func TestMaxAge(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w, WithMaxAge(10*time.Millisecond))
+	c.Incr("incr")
+	deadline := time.Now().Add(time.Second)
+	for len(w.Packets()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	packets := w.Packets()
+	if len(packets) != 1 {
+		t.Fatalf("incorrect number of packets, want 1, got %d", len(packets))
+	}
+	assert(t, packets[0], "incr:1|c")
+}
+
+func TestDialMaxAge(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c, err := Dial(l.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Incr("incr")
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	packet := make([]byte, 512)
+	n, _, err := l.ReadFrom(packet)
+	if err != nil {
+		t.Fatalf("expected the metric to be sent without flushing: %v", err)
+	}
+	assert(t, string(packet[:n]), "incr:1|c")
+}
+
+func TestClose(t *testing.T) {
+	c, err := Dial("127.0.0.1:8125")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Incr("incr")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Incr("incr"); err != ErrClosed {
+		t.Errorf("incorrect error, want %v, got %v", ErrClosed, err)
+	}
+	if err := c.Flush(); err != ErrClosed {
+		t.Errorf("incorrect error, want %v, got %v", ErrClosed, err)
+	}
+	if err := c.Close(); err != ErrClosed {
+		t.Errorf("incorrect error, want %v, got %v", ErrClosed, err)
+	}
+}
+
+func TestFlushEvery(t *testing.T) {
+	w := new(packetWriter)
+	c := NewClient(w)
+	stop := c.FlushEvery(5 * time.Millisecond)
+	c.Incr("incr")
+	deadline := time.Now().Add(time.Second)
+	for len(w.Packets()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	packets := w.Packets()
+	if len(packets) != 1 {
+		t.Fatalf("incorrect number of packets, want 1, got %d", len(packets))
+	}
+	assert(t, packets[0], "incr:1|c")
+	stop()
+	stop()
+}
+
+func TestFlushEveryDisabled(t *testing.T) {
+	c := NewClient(new(packetWriter))
+	c.FlushEvery(0)()
+	c.FlushEvery(-time.Second)()
+}
+
+func TestFlushEveryClose(t *testing.T) {
+	c, err := Dial("127.0.0.1:8125")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := c.FlushEvery(time.Millisecond)
+	c.Incr("incr")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+}
+
+func TestFlushEveryAfterClose(t *testing.T) {
+	c := NewClient(new(packetWriter))
+	c.Close()
+	c.FlushEvery(time.Millisecond)
+	c.m.Lock()
+	stops := len(c.stops)
+	c.m.Unlock()
+	if stops != 0 {
+		t.Errorf("expected no background flush on a closed client, got %d", stops)
+	}
+	// Nothing to wait for.
+	c.tickers.Wait()
+}
+
+func TestDialTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan string)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer conn.Close()
+		b, _ := ioutil.ReadAll(conn)
+		received <- string(b)
+	}()
+
+	c, err := DialTCP(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Incr("incr")
+	c.Flush()
+	c.Incr("incr")
+	c.Decr("decr")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, <-received, "incr:1|c\nincr:1|c\ndecr:-1|c\n")
+}
+
+func TestReconnect(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	now := time.Unix(0, 0)
+	c, err := newClient(&failingConn{broken: true}, 0, []Option{
+		WithClock(func() time.Time { return now }),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.addr = l.LocalAddr().String()
+
+	c.Incr("incr")
+	if err := c.Flush(); err == nil {
+		t.Fatal("expected an error from the broken connection")
+	}
+	assert(t, c.dialDelay.String(), minReconnectDelay.String())
+
+	c.Incr("incr")
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	assert(t, c.dialDelay.String(), "0s")
+
+	b := make([]byte, 512)
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := l.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, string(b[:n]), "incr:1|c")
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	now := time.Unix(0, 0)
+	c, err := newClient(&failingConn{broken: true}, 0, []Option{
+		WithClock(func() time.Time { return now }),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.network = "tcp"
+	c.addr = "127.0.0.1:1"
+
+	for _, delay := range []time.Duration{minReconnectDelay, 2 * minReconnectDelay, 4 * minReconnectDelay} {
+		c.Incr("incr")
+		c.Flush()
+		assert(t, c.dialDelay.String(), delay.String())
+		// No attempt is made before the delay elapsed.
+		c.Incr("incr")
+		c.Flush()
+		assert(t, c.dialDelay.String(), delay.String())
+		now = now.Add(delay)
+	}
+}
+
+func TestDialUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dsd.socket")
+	l, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for _, addr := range []string{path, "unix://" + path} {
+		c, err := Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Incr("incr")
+		c.Incr("incr")
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		b := make([]byte, 512)
+		l.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := l.ReadFrom(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert(t, string(b[:n]), "incr:1|c\nincr:1|c")
+	}
+}
+
+func TestDialUnixStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dsd.socket")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c, err := DialNetwork("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c.Incr("incr")
+	c.Incr("incr")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, string(b), "incr:1|c\nincr:1|c\n")
+}
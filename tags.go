@@ -0,0 +1,86 @@
+package statsd
+
+import (
+	"sort"
+	"strings"
+)
+
+// SetTags sets the tags appended to every metric sent by the client.
+// Tags are rendered sorted by key, a tag with an empty value is rendered as its key only.
+// Tags given to a metric take precedence over the default tags with the same key.
+func (c *Client) SetTags(tags map[string]string) {
+	copied := make(map[string]string, len(tags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+	rendered := formatTags(copied)
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.defaultTags = copied
+	c.tags = rendered
+}
+
+// formatTags serializes tags to their wire form, without the leading "|#".
+func formatTags(tags map[string]string) string {
+	return strings.Join(tagList(tags), ",")
+}
+
+// tagList renders tags sorted by key, as "key:value" or "key" for empty values.
+func tagList(tags map[string]string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	list := make([]string, len(keys))
+	for i, k := range keys {
+		list[i] = k
+		if v := tags[k]; v != "" {
+			list[i] += ":" + v
+		}
+	}
+	return list
+}
+
+// joinTags appends the given tags to the default ones, the lock must be held.
+// A default tag is left out when a given tag has the same key, so that per-call
+// tags take precedence.
+func (c *Client) joinTags(tags []string) string {
+	if len(tags) == 0 {
+		return c.tags
+	}
+	if c.tags == "" {
+		return strings.Join(tags, ",")
+	}
+	var overridden map[string]bool
+	for _, tag := range tags {
+		key := tagKey(tag)
+		if _, ok := c.defaultTags[key]; ok {
+			if overridden == nil {
+				overridden = make(map[string]bool)
+			}
+			overridden[key] = true
+		}
+	}
+	if len(overridden) == 0 {
+		return c.tags + "," + strings.Join(tags, ",")
+	}
+	merged := make([]string, 0, len(c.defaultTags)+len(tags))
+	for _, tag := range tagList(c.defaultTags) {
+		if !overridden[tagKey(tag)] {
+			merged = append(merged, tag)
+		}
+	}
+	return strings.Join(append(merged, tags...), ",")
+}
+
+// tagKey returns the key of a tag in its wire form.
+func tagKey(tag string) string {
+	if i := strings.IndexByte(tag, ':'); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
@@ -0,0 +1,107 @@
+package statsd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+var defaultTags = map[string]string{
+	"env":     "production",
+	"host":    "web-1",
+	"service": "api",
+	"canary":  "",
+}
+
+func TestSetTags(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	c.SetTags(defaultTags)
+	err := c.Incr("incr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "incr:1|c|#canary,env:production,host:web-1,service:api")
+}
+
+func TestSetTagsWithSequence(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithSequenceTracking())
+	c.SetTags(map[string]string{"env": "production"})
+	err := c.Incr("incr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "incr:1|c|#env:production,seq:1")
+}
+
+func TestTags(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	tags := map[string]string{"route": "/users", "canary": "", "method": "GET"}
+	c.IncrementTags("requests", 1, 1, tags)
+	c.DecrementTags("requests", 1, 1, tags)
+	c.TimingTags("latency", 350, 1, tags)
+	c.GaugeTags("workers", 10, 1, tags)
+	c.IncrementGaugeTags("workers", -2, 1, tags)
+	c.UniqueTags("users", 765, 1, tags)
+	c.Flush()
+	assert(t, buf.String(), "requests:1|c|#canary,method:GET,route:/users\n"+
+		"requests:-1|c|#canary,method:GET,route:/users\n"+
+		"latency:350|ms|#canary,method:GET,route:/users\n"+
+		"workers:10|g|#canary,method:GET,route:/users\n"+
+		"workers:-2|g|#canary,method:GET,route:/users\n"+
+		"users:765|s|#canary,method:GET,route:/users")
+}
+
+func TestTagsPrecedence(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithTags(map[string]string{"env": "production", "host": "web-1", "service": "api"}))
+	c.IncrementTags("requests", 1, 1, map[string]string{"route": "/users"})
+	c.IncrementTags("requests", 1, 1, map[string]string{"service": "worker", "host": ""})
+	c.Flush()
+	assert(t, buf.String(), "requests:1|c|#env:production,host:web-1,service:api,route:/users\n"+
+		"requests:1|c|#env:production,host,service:worker")
+}
+
+func TestTagsAfterRate(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	c.SetRandSource(&floatSource{values: []float64{0}})
+	c.SetTags(map[string]string{"env": "production"})
+	err := c.IncrementTags("requests", 1, 0.5, map[string]string{"route": "/users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "requests:1|c|@0.5|#env:production,route:/users")
+}
+
+func BenchmarkDefaultTags(b *testing.B) {
+	c := NewClient(ioutil.Discard)
+	c.SetTags(defaultTags)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.Incr("incr")
+	}
+}
+
+// BenchmarkFormatTags measures the cost saved on every send by caching the default tags.
+func BenchmarkFormatTags(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		formatTags(defaultTags)
+	}
+}
+
+func TestWithTagsCopied(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tags := map[string]string{"env": "production"}
+	c := NewClient(buf, WithTags(tags))
+	tags["host"] = "web-1"
+	c.IncrementTags("requests", 1, 1, map[string]string{"env": "staging"})
+	c.Flush()
+	assert(t, buf.String(), "requests:1|c|#env:staging")
+}
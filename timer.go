@@ -0,0 +1,43 @@
+package statsd
+
+import (
+	"sync"
+	"time"
+)
+
+// Timer measures the time elapsed since its creation, see NewTimer.
+type Timer struct {
+	c     *Client
+	stat  string
+	rate  float64
+	start time.Time
+	once  sync.Once
+}
+
+// NewTimer starts measuring the time spent for the given bucket, it is sent once
+// the returned timer is stopped. Typical usage is deferring the call to Send:
+//
+//	defer c.NewTimer("handler.latency", 1).Send()
+func (c *Client) NewTimer(stat string, rate float64) *Timer {
+	return &Timer{
+		c:     c,
+		stat:  stat,
+		rate:  rate,
+		start: time.Now(),
+	}
+}
+
+// Stop sends the time elapsed since the timer was created.
+// Only the first call sends it, the following ones do nothing.
+func (t *Timer) Stop() error {
+	var err error
+	t.once.Do(func() {
+		err = t.c.Duration(t.stat, time.Since(t.start), t.rate)
+	})
+	return err
+}
+
+// Send acts like Stop, it reads better in deferred calls.
+func (t *Timer) Send() error {
+	return t.Stop()
+}
@@ -0,0 +1,24 @@
+package statsd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNewTimer(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	func() {
+		timer := c.NewTimer("timer", 1)
+		defer timer.Stop()
+		defer timer.Send()
+	}()
+	c.Flush()
+	if !strings.HasPrefix(buf.String(), "timer:") || !strings.HasSuffix(buf.String(), "|ms") {
+		t.Errorf("incorrect timing, got %q", buf.String())
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 0 {
+		t.Errorf("expected a single timing, got %d", n+1)
+	}
+}
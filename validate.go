@@ -0,0 +1,92 @@
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseLine checks that line is a well formed metric:
+//
+//	name:value|type[|@rate][|#tag,...]
+//
+// It returns a descriptive error otherwise.
+func parseLine(line string) error {
+	i := strings.IndexByte(line, ':')
+	if i <= 0 {
+		return invalidLine(line, "missing bucket name")
+	}
+	name, rest := line[:i], line[i+1:]
+	if strings.ContainsAny(name, "|@\n") {
+		return invalidLine(line, "illegal character in bucket name")
+	}
+
+	segments := strings.Split(rest, "|")
+	if len(segments) < 2 {
+		return invalidLine(line, "missing metric type")
+	}
+	value, typ := segments[0], segments[1]
+	if value == "" {
+		return invalidLine(line, "missing value")
+	}
+	switch typ {
+	case "c", "ms", "h", "d":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return invalidLine(line, "value is not a number")
+		}
+	case "g":
+		if _, err := strconv.ParseFloat(strings.TrimPrefix(value, "+"), 64); err != nil {
+			return invalidLine(line, "value is not a number")
+		}
+	case "s", "a":
+		if strings.ContainsRune(value, '\n') {
+			return invalidLine(line, "illegal character in value")
+		}
+	default:
+		return invalidLine(line, fmt.Sprintf("unknown metric type %q", typ))
+	}
+
+	rate, tags := false, false
+	for _, segment := range segments[2:] {
+		switch {
+		case strings.HasPrefix(segment, "@"):
+			if rate || tags {
+				return invalidLine(line, "misplaced sample rate")
+			}
+			r, err := strconv.ParseFloat(segment[1:], 64)
+			if err != nil || r <= 0 || r > 1 {
+				return invalidLine(line, "invalid sample rate")
+			}
+			rate = true
+		case strings.HasPrefix(segment, "#"):
+			if tags {
+				return invalidLine(line, "duplicate tags")
+			}
+			for _, tag := range strings.Split(segment[1:], ",") {
+				if tag == "" || strings.ContainsRune(tag, '\n') {
+					return invalidLine(line, "invalid tag")
+				}
+			}
+			tags = true
+		default:
+			return invalidLine(line, fmt.Sprintf("unknown segment %q", segment))
+		}
+	}
+	return nil
+}
+
+// validateStat checks that a bucket name is not empty and leaves out the
+// characters delimiting the other parts of a metric line, see WithStrictNames.
+func validateStat(stat string) error {
+	if stat == "" {
+		return fmt.Errorf("statsd: empty bucket name")
+	}
+	if i := strings.IndexAny(stat, ":|@\n"); i >= 0 {
+		return fmt.Errorf("statsd: invalid bucket name %q: reserved character %q", stat, stat[i])
+	}
+	return nil
+}
+
+func invalidLine(line, reason string) error {
+	return fmt.Errorf("statsd: invalid metric %q: %s", line, reason)
+}
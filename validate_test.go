@@ -0,0 +1,80 @@
+package statsd
+
+import (
+	"bytes"
+	"testing"
+)
+
+var parseLineTests = []struct {
+	line  string
+	valid bool
+}{
+	{line: "incr:1|c", valid: true},
+	{line: "incr:-1|c|@0.1", valid: true},
+	{line: "gauge:+10|g|#env:production", valid: true},
+	{line: "timing:350|ms|@0.5|#env:production,canary", valid: true},
+	{line: "unique:user-1|s", valid: true},
+	{line: ":1|c", valid: false},
+	{line: "incr", valid: false},
+	{line: "incr:1", valid: false},
+	{line: "incr:|c", valid: false},
+	{line: "incr:%!d(string=a)|c", valid: false},
+	{line: "incr:1|x", valid: false},
+	{line: "incr:1|c|@2", valid: false},
+	{line: "incr:1|c|#env|@0.1", valid: false},
+	{line: "incr:1|c|#env,", valid: false},
+	{line: "incr:1|c|foo", valid: false},
+	{line: "in|cr:1|c", valid: false},
+}
+
+func TestParseLine(t *testing.T) {
+	for _, pt := range parseLineTests {
+		err := parseLine(pt.line)
+		if pt.valid && err != nil {
+			t.Errorf("%q: unexpected error %v", pt.line, err)
+		}
+		if !pt.valid && err == nil {
+			t.Errorf("%q: expected an error", pt.line)
+		}
+	}
+}
+
+func TestStrictValidation(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithStrictValidation())
+	err := c.Annotate("annotation", "multi\nline")
+	if err == nil {
+		t.Error("expected an error for an invalid metric")
+	}
+	err = c.Incr("incr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "incr:1|c")
+}
+
+func TestStrictNames(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf, WithStrictNames())
+	for _, stat := range []string{"", "in:cr", "in|cr", "in@cr", "in\ncr"} {
+		if err := c.Incr(stat); err == nil {
+			t.Errorf("%q: expected an error", stat)
+		}
+	}
+	if err := c.Incr("api.requests-total_2xx"); err != nil {
+		t.Error(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), "api.requests-total_2xx:1|c")
+}
+
+func TestLenientNames(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewClient(buf)
+	if err := c.Incr(""); err != nil {
+		t.Error(err)
+	}
+	c.Flush()
+	assert(t, buf.String(), ":1|c")
+}